@@ -3,23 +3,109 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/AstraBert/multipilot/shared"
 	"github.com/AstraBert/multipilot/workflow"
 	"github.com/google/uuid"
+	enums "go.temporal.io/api/enums/v1"
+	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
 )
 
-func ReadConfigToTasks(configFile string) (*shared.CopilotTasks, error) {
+var temporalConfig shared.TemporalConfig
+
+// dialTemporal resolves the connection settings when a command first needs
+// them, so that commands such as render work without a valid config file.
+func dialTemporal() (client.Client, error) {
+	config, err := ResolveTemporalConfig(configFile, configFormat, temporalFlags)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while loading the Temporal connection settings: %w", err)
+	}
+	temporalConfig = config
+	options, err := temporalConfig.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial(options)
+}
+
+// ResolveTemporalConfig merges the temporal section of the config file, if
+// any, with the environment variables and the flags, in increasing priority.
+func ResolveTemporalConfig(configFile, format string, flags shared.TemporalConfig) (shared.TemporalConfig, error) {
+	var config struct {
+		Temporal shared.TemporalConfig `json:"temporal" yaml:"temporal" toml:"temporal"`
+	}
+	format, err := shared.ConfigFormat(configFile, format)
+	if err != nil {
+		return shared.TemporalConfig{}, err
+	}
+	content, err := os.ReadFile(configFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// subcommands can run without a config file
+	case err != nil:
+		return shared.TemporalConfig{}, err
+	default:
+		if err := shared.DecodeConfig(configFile, content, format, &config); err != nil {
+			return shared.TemporalConfig{}, err
+		}
+		if config.Temporal, err = config.Temporal.Interpolate(filepath.Dir(configFile)); err != nil {
+			return shared.TemporalConfig{}, err
+		}
+	}
+	resolved := config.Temporal
+	resolved.Merge(shared.TemporalConfigFromEnv())
+	resolved.Merge(flags)
+	return resolved, nil
+}
+
+// ReadConfigToTasks reads the tasks from a JSON, YAML or TOML config file: the
+// format is detected from the extension of the file unless one is given.
+func ReadConfigToTasks(configFile, format string) (*shared.CopilotTasks, error) {
+	format, err := shared.ConfigFormat(configFile, format)
+	if err != nil {
+		return nil, err
+	}
 	content, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
 	var tasks shared.CopilotTasks
-	err = json.Unmarshal(content, &tasks)
+	err = shared.DecodeConfig(configFile, content, format, &tasks)
+	if err != nil {
+		return nil, err
+	}
+	// decode the config again as generic maps, so that the values a task sets to
+	// false or 0 win over the inherited ones
+	var fields shared.FieldsSet
+	err = shared.DecodeConfig(configFile, content, format, &fields)
+	if err != nil {
+		return nil, err
+	}
+	err = tasks.Inherit(&fields)
+	if err != nil {
+		return nil, err
+	}
+	err = tasks.Interpolate(filepath.Dir(configFile))
+	if err != nil {
+		return nil, err
+	}
+	err = tasks.Expand()
+	if err != nil {
+		return nil, err
+	}
+	err = loadPrompts(&tasks, configFile)
 	if err != nil {
 		return nil, err
 	}
@@ -30,16 +116,56 @@ func ReadConfigToTasks(configFile string) (*shared.CopilotTasks, error) {
 	return &tasks, nil
 }
 
-func RunCopilotWorkflow(input shared.CopilotInput) error {
-	c, err := client.Dial(client.Options{})
+// loadPrompts renders the prompt files of the tasks, once the targets and
+// models are expanded so that each copy gets its own prompt.
+func loadPrompts(tasks *shared.CopilotTasks, configFile string) error {
+	baseDir := filepath.Dir(configFile)
+	for i := range tasks.Tasks {
+		task := &tasks.Tasks[i]
+		if task.PromptFile == "" && task.SystemPromptFile == "" {
+			continue
+		}
+		repo, branch := workflow.RepositoryInfo(task.Cwd)
+		if err := task.LoadPrompts(baseDir, repo, branch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RunBatchWorkflow(tasks *shared.CopilotTasks) (*shared.BatchResult, error) {
+	c, err := dialTemporal()
 
 	if err != nil {
 		log.Println("Unable to create Temporal client:", err)
-		return err
+		return nil, err
 	}
 
 	defer c.Close()
 
+	we, _, err := startBatchWorkflow(c, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return getBatchResult(we)
+}
+
+func SubmitBatchWorkflow(tasks *shared.CopilotTasks) (*shared.BatchManifest, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	_, manifest, err := startBatchWorkflow(c, tasks)
+	return manifest, err
+}
+
+func startBatchWorkflow(c client.Client, tasks *shared.CopilotTasks) (client.WorkflowRun, *shared.BatchManifest, error) {
 	workflowId := "multipilot-" + uuid.New().String()
 
 	options := client.StartWorkflowOptions{
@@ -47,32 +173,771 @@ func RunCopilotWorkflow(input shared.CopilotInput) error {
 		TaskQueue: workflow.CopilotTaskQueue,
 	}
 
-	log.Printf("Assigning task with prompt %s and cwd %s to workflow with ID %s", input.Prompt, input.Cwd, workflowId)
+	if tasks.MaxParallel > 0 && tasks.MaxParallel < len(tasks.Tasks) {
+		log.Printf("At most %d tasks run at the same time: use `multipilot status %s` to see the pending ones\n", tasks.MaxParallel, workflowId)
+	}
+	for i, task := range tasks.Tasks {
+		log.Printf("Assigning task %s with %d turn(s) and cwd %s to workflow with ID %s", task.GetName(), len(task.GetTurns()), task.Cwd, workflow.ChildWorkflowID(workflowId, i))
+	}
 
-	we, err := c.ExecuteWorkflow(context.Background(), options, workflow.CopilotWorkflow, input)
+	we, err := c.ExecuteWorkflow(context.Background(), options, workflow.BatchWorkflow, *tasks)
 	if err != nil {
 		log.Println("Unable to start the Workflow:", err)
+		return nil, nil, err
+	}
+
+	log.Printf("Batch Workflow ID: %s, Run ID: %s\n", workflowId, we.GetRunID())
+	log.Printf("The batch keeps running if multipilot exits: use `multipilot result %s` to fetch its result later\n", workflowId)
+
+	return we, NewManifest(workflowId, we.GetRunID(), tasks), nil
+}
+
+func NewManifest(batchId, runId string, tasks *shared.CopilotTasks) *shared.BatchManifest {
+	manifest := &shared.BatchManifest{BatchID: batchId, RunID: runId, Tasks: make([]shared.ManifestTask, 0, len(tasks.Tasks))}
+	for i, task := range tasks.Tasks {
+		manifest.Tasks = append(manifest.Tasks, shared.ManifestTask{TaskID: task.GetName(), WorkflowID: workflow.ChildWorkflowID(batchId, i), LogFile: task.LogFile})
+	}
+	return manifest
+}
+
+func WriteManifest(manifest *shared.BatchManifest, manifestFile string) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
 		return err
 	}
+	return os.WriteFile(manifestFile, content, 0644)
+}
 
-	log.Printf("Workflow Run ID: %s\n", we.GetRunID())
+func LoadManifest(manifestFile string) (*shared.BatchManifest, error) {
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var manifest shared.BatchManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.BatchID == "" {
+		return nil, fmt.Errorf("%s is not a valid manifest: batch_id is missing", manifestFile)
+	}
+	return &manifest, nil
+}
 
-	var result error
+func FormatManifest(manifest *shared.BatchManifest) string {
+	lines := []string{fmt.Sprintf("Batch: %s", manifest.BatchID)}
+	for _, task := range manifest.Tasks {
+		lines = append(lines, fmt.Sprintf("- %s (%s), log: %s", task.TaskID, task.WorkflowID, task.LogFile))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
 
-	err = we.Get(context.Background(), &result)
+func GetBatchResult(workflowId string) (*shared.BatchResult, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	return getBatchResult(c.GetWorkflow(context.Background(), workflowId, ""))
+}
+
+func getBatchResult(we client.WorkflowRun) (*shared.BatchResult, error) {
+	var result shared.BatchResult
+
+	err := we.Get(context.Background(), &result)
 
 	if err != nil {
 		log.Println("Unable to get Workflow result:", err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func SendPromptToWorkflow(workflowId string, turn shared.CopilotTurn) error {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return err
+	}
+
+	defer c.Close()
+
+	return c.SignalWorkflow(context.Background(), workflowId, "", workflow.SendPromptSignal, turn)
+}
+
+func GetWorkflowStatus(workflowId string) (*shared.CopilotStatus, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	response, err := c.QueryWorkflow(context.Background(), workflowId, "", workflow.StatusQuery)
+	if err != nil {
+		return nil, err
+	}
+	var status shared.CopilotStatus
+	if err := response.Get(&status); err != nil {
+		return nil, err
+	}
+
+	description, err := c.DescribeWorkflowExecution(context.Background(), workflowId, "")
+	if err != nil {
+		return nil, err
+	}
+	// the query only knows what the workflow knows: the progress of the
+	// running activity comes from its latest heartbeat
+	for _, pending := range description.GetPendingActivities() {
+		var progress shared.CopilotProgress
+		if details := pending.GetHeartbeatDetails(); details != nil {
+			if err := converter.GetDefaultDataConverter().FromPayloads(details, &progress); err != nil {
+				return nil, err
+			}
+		}
+		status.ApplyProgress(progress, pending.GetAttempt())
+	}
+	if closeTime := description.GetWorkflowExecutionInfo().GetCloseTime(); closeTime != nil {
+		status.Elapsed = closeTime.AsTime().Sub(status.StartedAt)
+	} else {
+		status.Elapsed = time.Since(status.StartedAt)
+	}
+	return &status, nil
+}
+
+func CancelWorkflow(workflowId string) error {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return err
+	}
+
+	defer c.Close()
+
+	return c.CancelWorkflow(context.Background(), workflowId, "")
+}
+
+func TerminateWorkflow(workflowId, reason string) error {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
 		return err
 	}
 
-	if result != nil {
-		log.Println("Error during Copilot execution:", result)
-		return result
+	defer c.Close()
+
+	return c.TerminateWorkflow(context.Background(), workflowId, "", reason)
+}
+
+// RetryWorkflow starts a closed task or batch again, under the same workflow ID
+// and with the same input, and returns the ID of the new run.
+func RetryWorkflow(workflowId string) (string, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return "", err
+	}
+
+	defer c.Close()
+
+	response, err := c.DescribeWorkflowExecution(context.Background(), workflowId, "")
+	if err != nil {
+		return "", err
+	}
+	info := response.GetWorkflowExecutionInfo()
+	if info.GetStatus() == enums.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		return "", fmt.Errorf("workflow %s is still running: cancel it before retrying it", workflowId)
+	}
+	// the first event of the history holds the input of the workflow
+	started, err := c.GetWorkflowHistory(context.Background(), workflowId, "", false, enums.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).Next()
+	if err != nil {
+		return "", err
+	}
+	input := started.GetWorkflowExecutionStartedEventAttributes().GetInput()
+
+	options := client.StartWorkflowOptions{
+		ID:        workflowId,
+		TaskQueue: workflow.CopilotTaskQueue,
+	}
+	var we client.WorkflowRun
+	switch info.GetType().GetName() {
+	case BatchWorkflowType:
+		var tasks shared.CopilotTasks
+		if err := converter.GetDefaultDataConverter().FromPayloads(input, &tasks); err != nil {
+			return "", err
+		}
+		we, err = c.ExecuteWorkflow(context.Background(), options, workflow.BatchWorkflow, tasks)
+	case CopilotWorkflowType:
+		var task shared.CopilotInput
+		if err := converter.GetDefaultDataConverter().FromPayloads(input, &task); err != nil {
+			return "", err
+		}
+		options.Memo = workflow.TaskMemo(task)
+		if _, ok := info.GetSearchAttributes().GetIndexedFields()[workflow.CwdAttribute.GetName()]; ok {
+			options.TypedSearchAttributes = workflow.TaskSearchAttributes(task)
+		}
+		we, err = c.ExecuteWorkflow(context.Background(), options, workflow.CopilotWorkflow, task)
+	default:
+		return "", fmt.Errorf("workflow %s is neither a multipilot task nor a batch", workflowId)
+	}
+	if err != nil {
+		log.Println("Unable to start the Workflow:", err)
+		return "", err
+	}
+	return we.GetRunID(), nil
+}
+
+const BatchWorkflowType = "BatchWorkflow"
+
+func GetWorkflowType(workflowId string) (string, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return "", err
+	}
+
+	defer c.Close()
+
+	description, err := c.DescribeWorkflowExecution(context.Background(), workflowId, "")
+	if err != nil {
+		return "", err
+	}
+	return description.GetWorkflowExecutionInfo().GetType().GetName(), nil
+}
+
+func GetBatchStatus(workflowId string) (*shared.BatchStatus, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	response, err := c.QueryWorkflow(context.Background(), workflowId, "", workflow.StatusQuery)
+	if err != nil {
+		return nil, err
+	}
+	var status shared.BatchStatus
+	if err := response.Get(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func FormatBatchStatus(status *shared.BatchStatus) string {
+	lines := []string{fmt.Sprintf("Batch: %s", status.BatchID)}
+	if status.MaxParallel > 0 {
+		lines = append(lines, fmt.Sprintf("Max parallel tasks: %d", status.MaxParallel))
+	}
+	lines = append(lines, fmt.Sprintf("Pending: %d, running: %d, succeeded: %d, failed: %d, skipped: %d", status.Count(shared.TaskPending), status.Count(shared.TaskRunning), status.Count(shared.TaskSucceeded), status.Count(shared.TaskFailed), status.Count(shared.TaskSkipped)))
+	for _, task := range status.Tasks {
+		lines = append(lines, fmt.Sprintf("- %s (%s): %s", task.TaskID, task.WorkflowID, task.Status))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+const CopilotWorkflowType = "CopilotWorkflow"
+
+// ParseTimeFilter accepts either a RFC 3339 timestamp or a duration, counted
+// back from now.
+func ParseTimeFilter(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s: expected a RFC 3339 timestamp or a duration such as 24h", value)
+	}
+	return t, nil
+}
+
+func parseExecutionStatus(value string) (enums.WorkflowExecutionStatus, error) {
+	normalized := strings.ReplaceAll(value, "_", "")
+	for name, status := range enums.WorkflowExecutionStatus_shorthandValue {
+		if name != "Unspecified" && strings.EqualFold(name, normalized) {
+			return enums.WorkflowExecutionStatus(status), nil
+		}
+	}
+	return enums.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED, fmt.Errorf("invalid status %s: expected one of running, completed, failed, canceled, terminated or timed_out", value)
+}
+
+func quoteQueryValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "\\'") + "'"
+}
+
+// BuildListQuery turns the filters into a visibility query. The cwd and the
+// model are only part of the query when the search attributes are enabled:
+// otherwise they are matched against the memo of each workflow.
+func BuildListQuery(filter shared.WorkflowFilter) (string, error) {
+	workflowType := CopilotWorkflowType
+	if filter.Batches {
+		if filter.Cwd != "" || filter.Model != "" {
+			return "", errors.New("the cwd and model filters only apply to tasks")
+		}
+		workflowType = BatchWorkflowType
+	}
+	conditions := []string{"WorkflowType = " + quoteQueryValue(workflowType)}
+	if filter.Status != "" {
+		status, err := parseExecutionStatus(filter.Status)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, "ExecutionStatus = "+quoteQueryValue(status.String()))
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "StartTime >= "+quoteQueryValue(filter.Since.UTC().Format(time.RFC3339)))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "StartTime <= "+quoteQueryValue(filter.Until.UTC().Format(time.RFC3339)))
+	}
+	if filter.SearchAttributes {
+		if filter.Cwd != "" {
+			conditions = append(conditions, workflow.CwdAttribute.GetName()+" = "+quoteQueryValue(filter.Cwd))
+		}
+		if filter.Model != "" {
+			conditions = append(conditions, workflow.ModelAttribute.GetName()+" = "+quoteQueryValue(filter.Model))
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+func summarizeExecution(info *workflowpb.WorkflowExecutionInfo) (shared.WorkflowSummary, error) {
+	summary := shared.WorkflowSummary{
+		WorkflowID: info.GetExecution().GetWorkflowId(),
+		Type:       info.GetType().GetName(),
+		Status:     info.GetStatus().String(),
+		StartTime:  info.GetStartTime().AsTime(),
+	}
+	if info.GetCloseTime() != nil {
+		summary.CloseTime = info.GetCloseTime().AsTime()
+	}
+	fields := map[string]*string{
+		shared.MemoTaskName: &summary.TaskName,
+		shared.MemoCwd:      &summary.Cwd,
+		shared.MemoModel:    &summary.Model,
+		shared.MemoLogFile:  &summary.LogFile,
+	}
+	for key, field := range fields {
+		if payload, ok := info.GetMemo().GetFields()[key]; ok {
+			if err := converter.GetDefaultDataConverter().FromPayload(payload, field); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+func samePath(path, other string) bool {
+	if filepath.Clean(path) == filepath.Clean(other) {
+		return true
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absOther, err := filepath.Abs(other)
+	return err == nil && absPath == absOther
+}
+
+func matchesFilter(summary shared.WorkflowSummary, filter shared.WorkflowFilter) bool {
+	if filter.Cwd != "" && !samePath(summary.Cwd, filter.Cwd) {
+		return false
+	}
+	if filter.Model != "" && summary.Model != filter.Model {
+		return false
+	}
+	return true
+}
+
+func ListWorkflows(filter shared.WorkflowFilter, limit int) ([]shared.WorkflowSummary, error) {
+	query, err := BuildListQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	summaries := []shared.WorkflowSummary{}
+	var pageToken []byte
+	for {
+		response, err := c.ListWorkflow(context.Background(), &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     temporalConfig.GetNamespace(),
+			Query:         query,
+			NextPageToken: pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, execution := range response.GetExecutions() {
+			summary, err := summarizeExecution(execution)
+			if err != nil {
+				return nil, err
+			}
+			if !matchesFilter(summary, filter) {
+				continue
+			}
+			summaries = append(summaries, summary)
+			if limit > 0 && len(summaries) >= limit {
+				return summaries, nil
+			}
+		}
+		pageToken = response.GetNextPageToken()
+		if len(pageToken) == 0 {
+			return summaries, nil
+		}
+	}
+}
+
+func formatTiming(start, end time.Time) string {
+	if end.IsZero() {
+		return fmt.Sprintf("started %s", start.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("started %s, took %s", start.Format(time.RFC3339), end.Sub(start).Round(time.Second))
+}
+
+func FormatWorkflowList(summaries []shared.WorkflowSummary) string {
+	if len(summaries) == 0 {
+		return "No workflows found\n"
+	}
+	lines := []string{}
+	for _, summary := range summaries {
+		lines = append(lines, fmt.Sprintf("- %s: %s, %s", summary.WorkflowID, summary.Status, formatTiming(summary.StartTime, summary.CloseTime)))
+		if summary.TaskName != "" {
+			lines = append(lines, fmt.Sprintf("  Task: %s, model: %s, cwd: %s, log file: %s", summary.TaskName, summary.Model, summary.Cwd, summary.LogFile))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func DescribeWorkflow(workflowId string) (*shared.WorkflowDescription, error) {
+	c, err := dialTemporal()
+
+	if err != nil {
+		log.Println("Unable to create Temporal client:", err)
+		return nil, err
+	}
+
+	defer c.Close()
+
+	response, err := c.DescribeWorkflowExecution(context.Background(), workflowId, "")
+	if err != nil {
+		return nil, err
+	}
+	summary, err := summarizeExecution(response.GetWorkflowExecutionInfo())
+	if err != nil {
+		return nil, err
+	}
+	description := &shared.WorkflowDescription{WorkflowSummary: summary}
+
+	events := []*historypb.HistoryEvent{}
+	iterator := c.GetWorkflowHistory(context.Background(), workflowId, "", false, enums.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iterator.HasNext() {
+		event, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := describeHistory(description, events); err != nil {
+		return nil, err
+	}
+	// retries are only recorded in the history once the activity completes
+	for _, pending := range response.GetPendingActivities() {
+		for i := range description.Activities {
+			activity := &description.Activities[i]
+			if activity.ActivityID != pending.GetActivityId() {
+				continue
+			}
+			activity.Status = strings.ToLower(pending.GetState().String())
+			activity.Attempts = pending.GetAttempt()
+			activity.Error = pending.GetLastFailure().GetMessage()
+		}
+	}
+	return description, nil
+}
+
+// describeHistory fills the input, the activities and the outcome of a
+// workflow from its history. The tokens of the input are redacted.
+func describeHistory(description *shared.WorkflowDescription, events []*historypb.HistoryEvent) error {
+	dataConverter := converter.GetDefaultDataConverter()
+	activities := make(map[int64]int)
+	scheduledAt := make(map[int64]time.Time)
+	closeActivity := func(scheduledEventId int64, status string, failure *failurepb.Failure, closedAt time.Time) {
+		i, ok := activities[scheduledEventId]
+		if !ok {
+			return
+		}
+		description.Activities[i].Status = status
+		description.Activities[i].Error = failure.GetMessage()
+		description.Activities[i].Duration = closedAt.Sub(scheduledAt[scheduledEventId])
+	}
+	for _, event := range events {
+		switch event.GetEventType() {
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED:
+			input := event.GetWorkflowExecutionStartedEventAttributes().GetInput()
+			if description.Type == BatchWorkflowType {
+				var tasks shared.CopilotTasks
+				if err := dataConverter.FromPayloads(input, &tasks); err != nil {
+					return err
+				}
+				for i := range tasks.Tasks {
+					tasks.Tasks[i] = tasks.Tasks[i].Redacted()
+				}
+				description.Input = tasks
+			} else {
+				var task shared.CopilotInput
+				if err := dataConverter.FromPayloads(input, &task); err != nil {
+					return err
+				}
+				description.Input = task.Redacted()
+			}
+		case enums.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:
+			attributes := event.GetActivityTaskScheduledEventAttributes()
+			activities[event.GetEventId()] = len(description.Activities)
+			scheduledAt[event.GetEventId()] = event.GetEventTime().AsTime()
+			description.Activities = append(description.Activities, shared.ActivityAttempts{
+				ActivityID: attributes.GetActivityId(),
+				Activity:   attributes.GetActivityType().GetName(),
+				Status:     "scheduled",
+			})
+		case enums.EVENT_TYPE_ACTIVITY_TASK_STARTED:
+			attributes := event.GetActivityTaskStartedEventAttributes()
+			if i, ok := activities[attributes.GetScheduledEventId()]; ok {
+				description.Activities[i].Status = "started"
+				description.Activities[i].Attempts = attributes.GetAttempt()
+			}
+		case enums.EVENT_TYPE_ACTIVITY_TASK_COMPLETED:
+			closeActivity(event.GetActivityTaskCompletedEventAttributes().GetScheduledEventId(), "completed", nil, event.GetEventTime().AsTime())
+		case enums.EVENT_TYPE_ACTIVITY_TASK_FAILED:
+			attributes := event.GetActivityTaskFailedEventAttributes()
+			closeActivity(attributes.GetScheduledEventId(), "failed", attributes.GetFailure(), event.GetEventTime().AsTime())
+		case enums.EVENT_TYPE_ACTIVITY_TASK_TIMED_OUT:
+			attributes := event.GetActivityTaskTimedOutEventAttributes()
+			closeActivity(attributes.GetScheduledEventId(), "timed out", attributes.GetFailure(), event.GetEventTime().AsTime())
+		case enums.EVENT_TYPE_ACTIVITY_TASK_CANCELED:
+			closeActivity(event.GetActivityTaskCanceledEventAttributes().GetScheduledEventId(), "canceled", nil, event.GetEventTime().AsTime())
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED:
+			output := event.GetWorkflowExecutionCompletedEventAttributes().GetResult()
+			if description.Type == BatchWorkflowType {
+				var result shared.BatchResult
+				if err := dataConverter.FromPayloads(output, &result); err != nil {
+					return err
+				}
+				description.Result = result
+			} else {
+				var result shared.CopilotResult
+				if err := dataConverter.FromPayloads(output, &result); err != nil {
+					return err
+				}
+				description.Result = result
+			}
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:
+			description.Failure = event.GetWorkflowExecutionFailedEventAttributes().GetFailure().GetMessage()
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT:
+			description.Failure = "the workflow timed out"
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED:
+			description.Failure = fmt.Sprintf("the workflow was terminated: %s", event.GetWorkflowExecutionTerminatedEventAttributes().GetReason())
+		case enums.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED:
+			description.Failure = "the workflow was canceled"
+		}
+	}
+	return nil
+}
+
+func FormatDescription(description *shared.WorkflowDescription) (string, error) {
+	lines := []string{
+		fmt.Sprintf("Workflow: %s (%s)", description.WorkflowID, description.Type),
+		fmt.Sprintf("Status: %s, %s", description.Status, formatTiming(description.StartTime, description.CloseTime)),
+	}
+	if description.TaskName != "" {
+		lines = append(lines, fmt.Sprintf("Task: %s, model: %s, cwd: %s, log file: %s", description.TaskName, description.Model, description.Cwd, description.LogFile))
+	}
+	if len(description.Activities) > 0 {
+		lines = append(lines, "Activities:")
+		for _, activity := range description.Activities {
+			line := fmt.Sprintf("- %s (%s): %s after %d attempt(s)", activity.Activity, activity.ActivityID, activity.Status, activity.Attempts)
+			if activity.Duration > 0 {
+				line += fmt.Sprintf(" in %s", activity.Duration.Round(time.Second))
+			}
+			if activity.Error != "" {
+				line += fmt.Sprintf(", last error: %s", activity.Error)
+			}
+			lines = append(lines, line)
+		}
+	}
+	if description.Failure != "" {
+		lines = append(lines, fmt.Sprintf("Failure: %s", description.Failure))
+	}
+	input, err := indentJSON(description.Input)
+	if err != nil {
+		return "", err
+	}
+	lines = append(lines, "Input:", input)
+	if description.Result != nil {
+		result, err := indentJSON(description.Result)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, "Result:", result)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func indentJSON(value any) (string, error) {
+	var buffer strings.Builder
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+func FormatStatus(status *shared.CopilotStatus) string {
+	lines := []string{
+		fmt.Sprintf("Phase: %s", status.Phase),
+		fmt.Sprintf("Elapsed: %s", status.Elapsed.Round(time.Second)),
+	}
+	if status.Attempt > 0 {
+		lines = append(lines, fmt.Sprintf("Attempt: %d", status.Attempt))
+	}
+	if status.Turn > 0 {
+		lines = append(lines, fmt.Sprintf("Turn: %d", status.Turn))
+	}
+	if status.EventCount > 0 {
+		lines = append(lines, fmt.Sprintf("Events: %d (last: %s)", status.EventCount, status.LastEventType))
+	}
+	lines = append(lines, fmt.Sprintf("Follow-ups delivered: %d", status.FollowUpsDelivered))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func FormatSummary(result *shared.BatchResult) string {
+	results := []string{}
+	for _, outcome := range result.Tasks {
+		if outcome.Result != nil {
+			results = append(results, formatResult(outcome))
+		}
+	}
+	var taskResults string
+	if len(results) > 0 {
+		taskResults = "Results:\n" + strings.Join(results, "")
+	}
+	reasonsFailed := []string{}
+	for _, outcome := range result.Tasks {
+		switch {
+		case outcome.Status == shared.TaskSucceeded:
+			continue
+		case outcome.ErrorType != "":
+			reasonsFailed = append(reasonsFailed, fmt.Sprintf("%s (%s): [%s] %s", outcome.TaskID, outcome.WorkflowID, outcome.ErrorType, outcome.Error))
+		default:
+			reasonsFailed = append(reasonsFailed, fmt.Sprintf("%s (%s): %s", outcome.TaskID, outcome.WorkflowID, outcome.Error))
+		}
+	}
+	var comparisons string
+	if len(result.Comparisons) > 0 {
+		comparisons = "Model comparisons:\n"
+		for _, comparison := range result.Comparisons {
+			comparisons += formatComparison(comparison)
+		}
+	}
+	var failureReasons string
+	switch len(reasonsFailed) {
+	case 0:
+		failureReasons = "\n"
+	default:
+		failureReasons = "Failure reasons:\n- " + strings.Join(reasonsFailed, "\n- ") + "\n"
+	}
+	return fmt.Sprintf("Batch: %s\nSuccessfull tasks: %d\nFailed tasks: %d\nSkipped tasks: %d\n%s%s%s", result.BatchID, result.Succeeded, result.Failed, result.Skipped, taskResults, comparisons, failureReasons)
+}
+
+func formatComparison(comparison shared.ModelComparison) string {
+	summary := fmt.Sprintf("- %s (render it with `multipilot render --compare %s`)\n", comparison.Report, comparison.Report)
+	for _, run := range comparison.Runs {
+		summary += fmt.Sprintf("  %s: %s in %s, %d input / %d output tokens, %d tool call(s), %d file(s) changed (+%d -%d)\n", run.Model, run.Status, run.Duration.Round(time.Second), run.InputTokens, run.OutputTokens, run.ToolCalls, run.FilesChanged, run.Additions, run.Deletions)
+	}
+	return summary
+}
+
+func WriteComparisons(result *shared.BatchResult) error {
+	for _, comparison := range result.Comparisons {
+		content, err := json.MarshalIndent(comparison, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(comparison.Report, content, 0644); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func LoadComparison(reportFile string) (*shared.ModelComparison, error) {
+	content, err := os.ReadFile(reportFile)
+	if err != nil {
+		return nil, err
+	}
+	var comparison shared.ModelComparison
+	if err := json.Unmarshal(content, &comparison); err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+func formatResult(outcome shared.TaskOutcome) string {
+	result := outcome.Result
+	summary := fmt.Sprintf("- %s (%s): %d turn(s), %d tool call(s), %d input / %d output tokens, %d file(s) changed in %s, log: %s\n", outcome.TaskID, outcome.WorkflowID, result.Turns, result.ToolCalls, result.InputTokens, result.OutputTokens, len(result.FilesChanged), result.Duration.Round(time.Second), result.LogFile)
+	if len(result.FilesChanged) > 0 {
+		summary += fmt.Sprintf("  Files changed: %s\n", strings.Join(result.FilesChanged, ", "))
+	}
+	if result.Diff != nil {
+		summary += fmt.Sprintf("  Diff: +%d -%d in %d file(s), patch: %s\n", result.Diff.Additions, result.Diff.Deletions, len(result.Diff.Files), result.Diff.PatchFile)
+	}
+	if result.Verification != nil {
+		verification := "failed"
+		if result.Verification.Passed {
+			verification = "passed"
+		}
+		summary += fmt.Sprintf("  Verification: %s after %d iteration(s)\n", verification, result.Verification.Iterations)
+	}
+	if result.Branch != "" {
+		summary += fmt.Sprintf("  Branch: %s", result.Branch)
+		if result.Commit != "" {
+			summary += fmt.Sprintf(", commit: %s", result.Commit)
+		}
+		if result.Worktree != "" {
+			summary += fmt.Sprintf(" (worktree: %s)", result.Worktree)
+		}
+		summary += "\n"
+	}
+	if result.FinalMessage != "" {
+		summary += fmt.Sprintf("  Final message: %s\n", strings.ReplaceAll(strings.TrimSpace(result.FinalMessage), "\n", "\n  "))
+	}
+	return summary
+}
+
 func LoadEvents(logFile string) ([]shared.CopilotEvent, error) {
 	content, err := os.ReadFile(logFile)
 	if err != nil {
@@ -94,3 +959,15 @@ func LoadEvents(logFile string) ([]shared.CopilotEvent, error) {
 	}
 	return events, nil
 }
+
+func LoadDiff(logFile string) (*string, error) {
+	content, err := os.ReadFile(shared.DiffFile(logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	patch := string(content)
+	return &patch, nil
+}
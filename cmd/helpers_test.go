@@ -2,12 +2,21 @@ package cmd
 
 import (
 	"maps"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/AstraBert/multipilot/shared"
 	copilot "github.com/github/copilot-sdk/go"
+	commonpb "go.temporal.io/api/common/v1"
+	enums "go.temporal.io/api/enums/v1"
+	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func compareConfigs(cfg1, cfg2 *shared.CopilotTasks) bool {
@@ -32,6 +41,7 @@ func compareConfigs(cfg1, cfg2 *shared.CopilotTasks) bool {
 func TestReadConfigToTasks(t *testing.T) {
 	testCases := []struct {
 		configFile      string
+		format          string
 		expectedError   bool
 		validationError string
 		expectedConfig  *shared.CopilotTasks
@@ -75,6 +85,198 @@ func TestReadConfigToTasks(t *testing.T) {
 				},
 			},
 		},
+		{
+			configFile:      "../testfiles/configs/correct.yaml",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile:          "copilot-session-multipilot.jsonl",
+						Cwd:              "/Users/user/code-projects/multipilot",
+						LogLevel:         "info",
+						Env:              []string{},
+						Prompt:           "What is the workflow engine that the current project is using?",
+						GitHubToken:      "$GITHUB_TOKEN",
+						AiModel:          "gpt-4.1",
+						SystemPrompt:     "You are a helpful assistant that performs exploratory tasks within Go codebases.",
+						ExcludeTools:     []string{"shell(rm)", "write", "shell(rmdir)"},
+						Skills:           []string{},
+						LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{},
+						RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{},
+						Timeout:          300,
+					},
+					{
+						LogFile:          "copilot-session-workflowsacp.jsonl",
+						Cwd:              "/Users/user/code-projects/workflows-acp",
+						LogLevel:         "info",
+						Env:              []string{},
+						Prompt:           "What is the workflow engine that the current project is using?",
+						GitHubToken:      "$GITHUB_TOKEN",
+						AiModel:          "gpt-4.1",
+						SystemPrompt:     "You are a helpful assistant that performs exploratory tasks within python codebases managed with uv.",
+						ExcludeTools:     []string{"shell(rm)", "write", "shell(rmdir)"},
+						Skills:           []string{},
+						LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{},
+						RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{},
+						Timeout:          300,
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/correct.toml",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile:          "copilot-session-multipilot.jsonl",
+						Cwd:              "/Users/user/code-projects/multipilot",
+						LogLevel:         "info",
+						Env:              []string{},
+						Prompt:           "What is the workflow engine that the current project is using?",
+						GitHubToken:      "$GITHUB_TOKEN",
+						AiModel:          "gpt-4.1",
+						SystemPrompt:     "You are a helpful assistant that performs exploratory tasks within Go codebases.",
+						ExcludeTools:     []string{"shell(rm)", "write", "shell(rmdir)"},
+						Skills:           []string{},
+						LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{},
+						RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{},
+						Timeout:          300,
+					},
+					{
+						LogFile:          "copilot-session-workflowsacp.jsonl",
+						Cwd:              "/Users/user/code-projects/workflows-acp",
+						LogLevel:         "info",
+						Env:              []string{},
+						Prompt:           "What is the workflow engine that the current project is using?",
+						GitHubToken:      "$GITHUB_TOKEN",
+						AiModel:          "gpt-4.1",
+						SystemPrompt:     "You are a helpful assistant that performs exploratory tasks within python codebases managed with uv.",
+						ExcludeTools:     []string{"shell(rm)", "write", "shell(rmdir)"},
+						Skills:           []string{},
+						LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{},
+						RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{},
+						Timeout:          300,
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/invalid.yaml",
+			expectedError:   true,
+			validationError: "../testfiles/configs/invalid.yaml:6: tasks[1].timeout_sec: cannot unmarshal !!str `five mi...` into int64",
+			expectedConfig:  nil,
+		},
+		{
+			configFile:      "../testfiles/configs/invalid.toml",
+			expectedError:   true,
+			validationError: "../testfiles/configs/invalid.toml:8: tasks.timeout_sec: incompatible types: TOML value has type string; destination has type integer",
+			expectedConfig:  nil,
+		},
+		{
+			configFile:      "../testfiles/configs/invalid.toml",
+			format:          "yaml",
+			expectedError:   true,
+			validationError: "",
+			expectedConfig:  nil,
+		},
+		{
+			configFile:      "../testfiles/configs/correct.json",
+			format:          "xml",
+			expectedError:   true,
+			validationError: "invalid format xml: expected one of json, yaml or toml",
+			expectedConfig:  nil,
+		},
+		{
+			configFile:      "../testfiles/configs/targets.json",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile: "copilot-session-testfiles-configs.jsonl",
+						Cwd:     "../testfiles/configs",
+						Prompt:  "Describe the files within the current directory",
+						Timeout: 300,
+					},
+					{
+						LogFile: "copilot-session-testfiles-logs.jsonl",
+						Cwd:     "../testfiles/logs",
+						Prompt:  "Describe the files within the current directory",
+						Timeout: 300,
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/prompt_file.yaml",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile:      "copilot-session-review.jsonl",
+						Cwd:          "../testfiles/logs",
+						Prompt:       "Review the files in ../testfiles/logs for the copilot-session-review.jsonl task, focusing on error handling.",
+						SystemPrompt: "You are a careful reviewer using gpt-4.1.",
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/profiles.toml",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile:  "copilot-session-configs.jsonl",
+						Cwd:      "../testfiles/configs",
+						LogLevel: "info",
+						AiModel:  "gpt-5",
+						Prompt:   "Describe the files within the current directory",
+						Timeout:  300,
+					},
+					{
+						LogFile:      "copilot-session-logs.jsonl",
+						Cwd:          "../testfiles/logs",
+						LogLevel:     "debug",
+						AiModel:      "gpt-5",
+						SystemPrompt: "Do not change the public API.",
+						Prompt:       "Describe the files within the current directory",
+						Timeout:      600,
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/interpolate.yaml",
+			expectedError:   false,
+			validationError: "",
+			expectedConfig: &shared.CopilotTasks{
+				Tasks: []shared.CopilotInput{
+					{
+						LogFile: "copilot-session-logs.jsonl",
+						Cwd:     "../testfiles/logs",
+						Prompt:  "Describe the files within the current directory",
+					},
+				},
+			},
+		},
+		{
+			configFile:      "../testfiles/configs/unresolved.yaml",
+			expectedError:   true,
+			validationError: "unresolved environment variables: MULTIPILOT_TEST_UNSET (tasks[1].cwd), MULTIPILOT_TEST_OTHER (tasks[1].ai_model)",
+			expectedConfig:  nil,
+		},
+		{
+			configFile:      "../testfiles/configs/unresolved_secrets.yaml",
+			expectedError:   true,
+			validationError: "unresolved environment variables: MULTIPILOT_TEST_API_KEY (tasks[0].env[1]), MULTIPILOT_TEST_DOCS_KEY (tasks[0].remote_mcp_servers.docs.headers.Authorization)",
+			expectedConfig:  nil,
+		},
 		{
 			configFile:      "../testfiles/configs/invalid.json",
 			expectedError:   true,
@@ -90,7 +292,7 @@ func TestReadConfigToTasks(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		config, err := ReadConfigToTasks(tc.configFile)
+		config, err := ReadConfigToTasks(tc.configFile, tc.format)
 		if tc.expectedError && err != nil {
 			if tc.validationError != "" && err.Error() != tc.validationError {
 				t.Fatalf("Expected a validation error to occur with message %s, got %s", tc.validationError, err.Error())
@@ -106,6 +308,61 @@ func TestReadConfigToTasks(t *testing.T) {
 	}
 }
 
+func TestResolveTemporalConfig(t *testing.T) {
+	t.Setenv("TEMPORAL_ADDRESS", "")
+	t.Setenv("TEMPORAL_NAMESPACE", "staging")
+	t.Setenv("TEMPORAL_TLS_CERT", "")
+	t.Setenv("TEMPORAL_TLS_KEY", "")
+	t.Setenv("TEMPORAL_API_KEY", "env-key")
+	testCases := []struct {
+		configFile     string
+		flags          shared.TemporalConfig
+		expectedConfig shared.TemporalConfig
+		expectedError  bool
+	}{
+		{
+			configFile:     "../testfiles/configs/temporal.json",
+			flags:          shared.TemporalConfig{APIKey: "flag-key"},
+			expectedConfig: shared.TemporalConfig{Address: "temporal.internal:7233", Namespace: "staging", APIKey: "flag-key"},
+		},
+		{
+			configFile:     "../testfiles/configs/missing.json",
+			flags:          shared.TemporalConfig{Address: "localhost:7233"},
+			expectedConfig: shared.TemporalConfig{Address: "localhost:7233", Namespace: "staging", APIKey: "env-key"},
+		},
+		{
+			configFile:     "../testfiles/configs/temporal.yaml",
+			expectedConfig: shared.TemporalConfig{Address: "temporal.internal:7233", Namespace: "staging", APIKey: "env-key"},
+		},
+		{
+			configFile:    "../testfiles/configs/nojson.txt",
+			expectedError: true,
+		},
+	}
+	t.Setenv("MULTIPILOT_TEST_TEMPORAL_KEY", "secret-key")
+	for _, tc := range testCases {
+		config, err := ResolveTemporalConfig(tc.configFile, "", tc.flags)
+		if tc.expectedError {
+			if err == nil {
+				t.Fatal("Expected an error to occur, but got none")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		if config != tc.expectedConfig {
+			t.Fatalf("Expected config to be %v, got %v", tc.expectedConfig, config)
+		}
+	}
+
+	os.Unsetenv("MULTIPILOT_TEST_TEMPORAL_KEY")
+	expectedError := "unresolved environment variables: MULTIPILOT_TEST_TEMPORAL_KEY (temporal.api_key)"
+	if _, err := ResolveTemporalConfig("../testfiles/configs/temporal.yaml", "", shared.TemporalConfig{}); err == nil || err.Error() != expectedError {
+		t.Fatalf("Expected error %q, got %v", expectedError, err)
+	}
+}
+
 func compareEvents(ev1, ev2 shared.CopilotEvent) bool {
 	return ev1.ID == ev2.ID && ev1.Type == ev2.Type && maps.Equal(ev1.Data, ev2.Data) && ev1.Timestamp.Equal(ev2.Timestamp)
 }
@@ -160,3 +417,372 @@ func TestLoadEvents(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatSummary(t *testing.T) {
+	testCases := []struct {
+		result          *shared.BatchResult
+		expectedSummary string
+	}{
+		{
+			result: &shared.BatchResult{
+				BatchID:   "multipilot-123",
+				Tasks:     []shared.TaskOutcome{{TaskID: "backend", WorkflowID: "multipilot-123-task-0", Status: shared.TaskSucceeded}},
+				Succeeded: 1,
+			},
+			expectedSummary: "Batch: multipilot-123\nSuccessfull tasks: 1\nFailed tasks: 0\nSkipped tasks: 0\n\n",
+		},
+		{
+			result: &shared.BatchResult{
+				BatchID: "multipilot-123",
+				Tasks: []shared.TaskOutcome{
+					{
+						TaskID:     "backend",
+						WorkflowID: "multipilot-123-task-0",
+						Status:     shared.TaskSucceeded,
+						Result: &shared.CopilotResult{
+							FinalMessage: "Done.\nAll handlers are validated.",
+							Turns:        2,
+							ToolCalls:    5,
+							InputTokens:  1200,
+							OutputTokens: 340,
+							Duration:     90 * time.Second,
+							FilesChanged: []string{"handlers.go", "handlers_test.go"},
+							LogFile:      "backend.jsonl",
+						},
+					},
+				},
+				Succeeded: 1,
+			},
+			expectedSummary: "Batch: multipilot-123\nSuccessfull tasks: 1\nFailed tasks: 0\nSkipped tasks: 0\nResults:\n- backend (multipilot-123-task-0): 2 turn(s), 5 tool call(s), 1200 input / 340 output tokens, 2 file(s) changed in 1m30s, log: backend.jsonl\n  Files changed: handlers.go, handlers_test.go\n  Final message: Done.\n  All handlers are validated.\n\n",
+		},
+		{
+			result: &shared.BatchResult{
+				BatchID: "multipilot-123",
+				Tasks: []shared.TaskOutcome{
+					{TaskID: "backend", WorkflowID: "multipilot-123-task-0", Status: shared.TaskFailed, Error: "activity failure", ErrorType: shared.AuthenticationError},
+					{TaskID: "frontend", WorkflowID: "multipilot-123-task-1", Status: shared.TaskSkipped, Error: "skipped because dependency backend did not succeed"},
+				},
+				Failed:  1,
+				Skipped: 1,
+			},
+			expectedSummary: "Batch: multipilot-123\nSuccessfull tasks: 0\nFailed tasks: 1\nSkipped tasks: 1\nFailure reasons:\n- backend (multipilot-123-task-0): [AuthenticationError] activity failure\n- frontend (multipilot-123-task-1): skipped because dependency backend did not succeed\n",
+		},
+		{
+			result: &shared.BatchResult{
+				BatchID: "multipilot-123",
+				Tasks: []shared.TaskOutcome{
+					{TaskID: "refactor-gpt-5", WorkflowID: "multipilot-123-task-0", Status: shared.TaskSucceeded},
+					{TaskID: "refactor-claude-sonnet-4.5", WorkflowID: "multipilot-123-task-1", Status: shared.TaskSucceeded},
+				},
+				Succeeded: 2,
+				Comparisons: []shared.ModelComparison{
+					{
+						Report: "refactor-comparison.json",
+						Runs: []shared.ModelRun{
+							{Model: "gpt-5", Status: shared.TaskSucceeded, Duration: 2 * time.Minute, InputTokens: 1000, OutputTokens: 200, ToolCalls: 4, FilesChanged: 2, Additions: 10, Deletions: 3},
+							{Model: "claude-sonnet-4.5", Status: shared.TaskSucceeded, Duration: 90 * time.Second, InputTokens: 800, OutputTokens: 150, ToolCalls: 6, FilesChanged: 1, Additions: 7, Deletions: 1},
+						},
+					},
+				},
+			},
+			expectedSummary: "Batch: multipilot-123\nSuccessfull tasks: 2\nFailed tasks: 0\nSkipped tasks: 0\nModel comparisons:\n- refactor-comparison.json (render it with `multipilot render --compare refactor-comparison.json`)\n  gpt-5: succeeded in 2m0s, 1000 input / 200 output tokens, 4 tool call(s), 2 file(s) changed (+10 -3)\n  claude-sonnet-4.5: succeeded in 1m30s, 800 input / 150 output tokens, 6 tool call(s), 1 file(s) changed (+7 -1)\n\n",
+		},
+	}
+	for _, tc := range testCases {
+		summary := FormatSummary(tc.result)
+		if summary != tc.expectedSummary {
+			t.Fatalf("Expected summary to be %q, got %q", tc.expectedSummary, summary)
+		}
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	testCases := []struct {
+		status         *shared.CopilotStatus
+		expectedStatus string
+	}{
+		{
+			status:         &shared.CopilotStatus{Phase: shared.PhaseCompleted, Elapsed: 90*time.Second + 300*time.Millisecond, FollowUpsDelivered: 2},
+			expectedStatus: "Phase: completed\nElapsed: 1m30s\nFollow-ups delivered: 2\n",
+		},
+		{
+			status:         &shared.CopilotStatus{Phase: shared.PhaseToolRunning, Elapsed: 5 * time.Second, Attempt: 2, Turn: 1, EventCount: 7, LastEventType: "tool.execution_start"},
+			expectedStatus: "Phase: tool running\nElapsed: 5s\nAttempt: 2\nTurn: 1\nEvents: 7 (last: tool.execution_start)\nFollow-ups delivered: 0\n",
+		},
+	}
+	for _, tc := range testCases {
+		status := FormatStatus(tc.status)
+		if status != tc.expectedStatus {
+			t.Fatalf("Expected status to be %q, got %q", tc.expectedStatus, status)
+		}
+	}
+}
+
+func TestFormatBatchStatus(t *testing.T) {
+	status := &shared.BatchStatus{
+		BatchID:     "multipilot-123",
+		MaxParallel: 1,
+		Tasks: []shared.TaskOutcome{
+			{TaskID: "backend", WorkflowID: "multipilot-123-task-0", Status: shared.TaskSucceeded},
+			{TaskID: "frontend", WorkflowID: "multipilot-123-task-1", Status: shared.TaskRunning},
+			{TaskID: "docs", WorkflowID: "multipilot-123-task-2", Status: shared.TaskPending},
+		},
+	}
+	expectedStatus := "Batch: multipilot-123\nMax parallel tasks: 1\nPending: 1, running: 1, succeeded: 1, failed: 0, skipped: 0\n- backend (multipilot-123-task-0): succeeded\n- frontend (multipilot-123-task-1): running\n- docs (multipilot-123-task-2): pending\n"
+	if formatted := FormatBatchStatus(status); formatted != expectedStatus {
+		t.Fatalf("Expected status to be %q, got %q", expectedStatus, formatted)
+	}
+}
+
+func TestLoadDiff(t *testing.T) {
+	diff, err := LoadDiff("../testfiles/logs/valid.logs")
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if diff == nil || !strings.HasPrefix(*diff, "diff --git a/main.go b/main.go\n") {
+		t.Fatalf("Expected the diff stored next to the log file, got %v", diff)
+	}
+	diff, err = LoadDiff("../testfiles/logs/invalid.logs")
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if diff != nil {
+		t.Fatalf("Expected no diff, got %s", *diff)
+	}
+}
+
+func TestWriteAndLoadComparison(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "refactor-comparison.json")
+	result := &shared.BatchResult{
+		Comparisons: []shared.ModelComparison{
+			{
+				Report: report,
+				Runs: []shared.ModelRun{
+					{Model: "gpt-5", Status: shared.TaskSucceeded, LogFile: "refactor-gpt-5.jsonl", Duration: time.Minute, ToolCalls: 4},
+					{Model: "claude-sonnet-4.5", Status: shared.TaskFailed, Error: "model is not available", LogFile: "refactor-claude-sonnet-4.5.jsonl"},
+				},
+			},
+		},
+	}
+	if err := WriteComparisons(result); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	comparison, err := LoadComparison(report)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if comparison.Report != report || !slices.Equal(comparison.Runs, result.Comparisons[0].Runs) {
+		t.Fatalf("Expected the comparison to be %v, got %v", result.Comparisons[0], comparison)
+	}
+	if _, err := LoadComparison(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Expected an error for a missing report, got none")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	tasks := &shared.CopilotTasks{
+		Tasks: []shared.CopilotInput{
+			{ID: "backend", LogFile: "backend.jsonl"},
+			{LogFile: "frontend.jsonl"},
+		},
+	}
+	manifest := NewManifest("multipilot-123", "run-456", tasks)
+	expected := []shared.ManifestTask{
+		{TaskID: "backend", WorkflowID: "multipilot-123-task-0", LogFile: "backend.jsonl"},
+		{TaskID: "frontend.jsonl", WorkflowID: "multipilot-123-task-1", LogFile: "frontend.jsonl"},
+	}
+	if manifest.BatchID != "multipilot-123" || manifest.RunID != "run-456" || !slices.Equal(manifest.Tasks, expected) {
+		t.Fatalf("Unexpected manifest: %v", manifest)
+	}
+	expectedFormat := "Batch: multipilot-123\n- backend (multipilot-123-task-0), log: backend.jsonl\n- frontend.jsonl (multipilot-123-task-1), log: frontend.jsonl\n"
+	if formatted := FormatManifest(manifest); formatted != expectedFormat {
+		t.Fatalf("Expected manifest to be formatted as %q, got %q", expectedFormat, formatted)
+	}
+
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+	if err := WriteManifest(manifest, manifestFile); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	loaded, err := LoadManifest(manifestFile)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if loaded.BatchID != manifest.BatchID || loaded.RunID != manifest.RunID || !slices.Equal(loaded.Tasks, manifest.Tasks) {
+		t.Fatalf("Expected the loaded manifest to be %v, got %v", manifest, loaded)
+	}
+	if _, err := LoadManifest("../testfiles/configs/correct.json"); err == nil || err.Error() != "../testfiles/configs/correct.json is not a valid manifest: batch_id is missing" {
+		t.Fatalf("Expected an error for a file that is not a manifest, got %v", err)
+	}
+}
+
+func TestBuildListQuery(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		filter        shared.WorkflowFilter
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "no filter",
+			filter:   shared.WorkflowFilter{Cwd: "/repo", Model: "gpt-5"},
+			expected: "WorkflowType = 'CopilotWorkflow'",
+		},
+		{
+			name:     "status and time range",
+			filter:   shared.WorkflowFilter{Status: "timed_out", Since: since, Until: since.Add(time.Hour)},
+			expected: "WorkflowType = 'CopilotWorkflow' AND ExecutionStatus = 'TimedOut' AND StartTime >= '2026-01-02T03:04:05Z' AND StartTime <= '2026-01-02T04:04:05Z'",
+		},
+		{
+			name:     "search attributes",
+			filter:   shared.WorkflowFilter{Status: "Running", Cwd: "/it's", Model: "gpt-5", SearchAttributes: true},
+			expected: "WorkflowType = 'CopilotWorkflow' AND ExecutionStatus = 'Running' AND MultipilotCwd = '/it\\'s' AND MultipilotModel = 'gpt-5'",
+		},
+		{
+			name:     "batches",
+			filter:   shared.WorkflowFilter{Batches: true, Status: "completed"},
+			expected: "WorkflowType = 'BatchWorkflow' AND ExecutionStatus = 'Completed'",
+		},
+		{
+			name:          "batches with cwd",
+			filter:        shared.WorkflowFilter{Batches: true, Cwd: "/repo"},
+			expectedError: "the cwd and model filters only apply to tasks",
+		},
+		{
+			name:          "invalid status",
+			filter:        shared.WorkflowFilter{Status: "done"},
+			expectedError: "invalid status done: expected one of running, completed, failed, canceled, terminated or timed_out",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := BuildListQuery(tc.filter)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Not expecting an error, got %s", err.Error())
+			}
+			if query != tc.expected {
+				t.Fatalf("Expected query %q, got %q", tc.expected, query)
+			}
+		})
+	}
+}
+
+func TestParseTimeFilter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if parsed, err := ParseTimeFilter("", now); err != nil || !parsed.IsZero() {
+		t.Fatalf("Expected an empty value to be the zero time, got %v (%v)", parsed, err)
+	}
+	if parsed, err := ParseTimeFilter("2h", now); err != nil || !parsed.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("Expected a duration to be counted back from now, got %v (%v)", parsed, err)
+	}
+	if parsed, err := ParseTimeFilter("2025-12-31T00:00:00Z", now); err != nil || !parsed.Equal(time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected a timestamp to be parsed, got %v (%v)", parsed, err)
+	}
+	if _, err := ParseTimeFilter("yesterday", now); err == nil || err.Error() != "invalid time yesterday: expected a RFC 3339 timestamp or a duration such as 24h" {
+		t.Fatalf("Expected an error for an invalid time, got %v", err)
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	summary := shared.WorkflowSummary{Cwd: "/repo/backend/", Model: "gpt-5"}
+	testCases := []struct {
+		filter   shared.WorkflowFilter
+		expected bool
+	}{
+		{filter: shared.WorkflowFilter{}, expected: true},
+		{filter: shared.WorkflowFilter{Cwd: "/repo/backend", Model: "gpt-5"}, expected: true},
+		{filter: shared.WorkflowFilter{Cwd: "/repo/frontend"}, expected: false},
+		{filter: shared.WorkflowFilter{Model: "gpt-4.1"}, expected: false},
+	}
+	for _, tc := range testCases {
+		if matched := matchesFilter(summary, tc.filter); matched != tc.expected {
+			t.Fatalf("Expected filter %v to match: %v, got %v", tc.filter, tc.expected, matched)
+		}
+	}
+}
+
+func historyEvent(t *testing.T, id int64, at time.Time, attributes any) *historypb.HistoryEvent {
+	event := &historypb.HistoryEvent{EventId: id, EventTime: timestamppb.New(at)}
+	switch a := attributes.(type) {
+	case *historypb.WorkflowExecutionStartedEventAttributes:
+		event.EventType = enums.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED
+		event.Attributes = &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{WorkflowExecutionStartedEventAttributes: a}
+	case *historypb.ActivityTaskScheduledEventAttributes:
+		event.EventType = enums.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED
+		event.Attributes = &historypb.HistoryEvent_ActivityTaskScheduledEventAttributes{ActivityTaskScheduledEventAttributes: a}
+	case *historypb.ActivityTaskStartedEventAttributes:
+		event.EventType = enums.EVENT_TYPE_ACTIVITY_TASK_STARTED
+		event.Attributes = &historypb.HistoryEvent_ActivityTaskStartedEventAttributes{ActivityTaskStartedEventAttributes: a}
+	case *historypb.ActivityTaskFailedEventAttributes:
+		event.EventType = enums.EVENT_TYPE_ACTIVITY_TASK_FAILED
+		event.Attributes = &historypb.HistoryEvent_ActivityTaskFailedEventAttributes{ActivityTaskFailedEventAttributes: a}
+	case *historypb.WorkflowExecutionFailedEventAttributes:
+		event.EventType = enums.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED
+		event.Attributes = &historypb.HistoryEvent_WorkflowExecutionFailedEventAttributes{WorkflowExecutionFailedEventAttributes: a}
+	default:
+		t.Fatalf("Unexpected attributes %T", attributes)
+	}
+	return event
+}
+
+func TestDescribeHistory(t *testing.T) {
+	input, err := converter.GetDefaultDataConverter().ToPayloads(shared.CopilotInput{LogFile: "backend.jsonl", GitHubToken: "ghp_secret", Prompt: "Fix the tests"})
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []*historypb.HistoryEvent{
+		historyEvent(t, 1, start, &historypb.WorkflowExecutionStartedEventAttributes{Input: input}),
+		historyEvent(t, 5, start, &historypb.ActivityTaskScheduledEventAttributes{ActivityId: "5", ActivityType: &commonpb.ActivityType{Name: "RunCopilot"}}),
+		historyEvent(t, 6, start.Add(time.Minute), &historypb.ActivityTaskStartedEventAttributes{ScheduledEventId: 5, Attempt: 3}),
+		historyEvent(t, 7, start.Add(2*time.Minute), &historypb.ActivityTaskFailedEventAttributes{ScheduledEventId: 5, Failure: &failurepb.Failure{Message: "invalid model"}}),
+		historyEvent(t, 11, start.Add(2*time.Minute), &historypb.WorkflowExecutionFailedEventAttributes{Failure: &failurepb.Failure{Message: "activity error"}}),
+	}
+	description := &shared.WorkflowDescription{WorkflowSummary: shared.WorkflowSummary{WorkflowID: "multipilot-123-task-0", Type: CopilotWorkflowType, Status: "Failed"}}
+	if err := describeHistory(description, events); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	task, ok := description.Input.(shared.CopilotInput)
+	if !ok || task.GitHubToken != shared.RedactedToken || task.Prompt != "Fix the tests" {
+		t.Fatalf("Expected the input to be decoded with its token redacted, got %v", description.Input)
+	}
+	expected := []shared.ActivityAttempts{{ActivityID: "5", Activity: "RunCopilot", Status: "failed", Attempts: 3, Duration: 2 * time.Minute, Error: "invalid model"}}
+	if !slices.Equal(description.Activities, expected) {
+		t.Fatalf("Expected activities %v, got %v", expected, description.Activities)
+	}
+	if description.Failure != "activity error" {
+		t.Fatalf("Expected failure %q, got %q", "activity error", description.Failure)
+	}
+	formatted, err := FormatDescription(description)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	for _, line := range []string{"Workflow: multipilot-123-task-0 (CopilotWorkflow)", "- RunCopilot (5): failed after 3 attempt(s) in 2m0s, last error: invalid model", "Failure: activity error", `"token": "<redacted>"`} {
+		if !strings.Contains(formatted, line) {
+			t.Fatalf("Expected %q within the description, got %q", line, formatted)
+		}
+	}
+	if strings.Contains(formatted, "ghp_secret") {
+		t.Fatalf("Expected the token to be redacted, got %q", formatted)
+	}
+}
+
+func TestDialTemporalInvalidConfig(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "multipilot.config.json")
+	if err := os.WriteFile(invalid, []byte("{\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := configFile
+	configFile = invalid
+	defer func() { configFile = previous }()
+	_, err := dialTemporal()
+	if err == nil || !strings.Contains(err.Error(), "multipilot.config.json:2: unexpected end of JSON input") {
+		t.Fatalf("Expected the invalid config to be reported when dialing, got %v", err)
+	}
+}
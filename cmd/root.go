@@ -5,10 +5,10 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strings"
-	"sync"
+	"time"
 
 	"github.com/AstraBert/multipilot/components"
+	"github.com/AstraBert/multipilot/shared"
 	"github.com/AstraBert/multipilot/worker"
 	"github.com/a-h/templ"
 	"github.com/spf13/cobra"
@@ -17,7 +17,11 @@ import (
 const DefaultConfigFile = "multipilot.config.json"
 
 var configFile string
+var configFormat string
 var showHelp bool
+var maxParallel int
+var searchAttributes bool
+var temporalFlags shared.TemporalConfig
 
 var rootCmd = &cobra.Command{
 	Use:   "multipilot",
@@ -28,79 +32,308 @@ var rootCmd = &cobra.Command{
 			_ = cmd.Help()
 			return
 		}
-		tasks, err := ReadConfigToTasks(configFile)
+		tasks, err := ReadConfigToTasks(configFile, configFormat)
 		if err != nil {
 			log.Println("An error occurred while loading the configuration: ", err)
 			return
 		}
-		var wg sync.WaitGroup
-		errChan := make(chan error)
-		for _, task := range tasks.Tasks {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				err := RunCopilotWorkflow(task)
-				errChan <- err
-			}()
-		}
-		go func() {
-			wg.Wait()
-			close(errChan)
-		}()
-
-		success := 0
-		failed := 0
-		reasonsFailed := []string{}
-
-		for e := range errChan {
-			if e != nil {
-				failed += 1
-				reasonsFailed = append(reasonsFailed, e.Error())
-			} else {
-				success += 1
+		if maxParallel > 0 {
+			tasks.MaxParallel = maxParallel
+		}
+		if searchAttributes {
+			tasks.SearchAttributes = true
+		}
+		result, err := RunBatchWorkflow(tasks)
+		if err != nil {
+			log.Println("An error occurred while running the tasks: ", err)
+			return
+		}
+		if err := WriteComparisons(result); err != nil {
+			log.Println("An error occurred while writing the model comparisons: ", err)
+		}
+		fmt.Print(FormatSummary(result))
+	},
+}
+
+var manifestFile string
+
+var submitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Submit a batch of Copilot tasks without waiting for them",
+	Long:  "Start the workflows of a batch of Copilot tasks and print their workflow IDs and log files right away, optionally writing them to a JSON manifest to use with `multipilot wait`",
+	Run: func(cmd *cobra.Command, args []string) {
+		tasks, err := ReadConfigToTasks(configFile, configFormat)
+		if err != nil {
+			log.Println("An error occurred while loading the configuration: ", err)
+			return
+		}
+		if maxParallel > 0 {
+			tasks.MaxParallel = maxParallel
+		}
+		if searchAttributes {
+			tasks.SearchAttributes = true
+		}
+		manifest, err := SubmitBatchWorkflow(tasks)
+		if err != nil {
+			log.Println("An error occurred while submitting the tasks: ", err)
+			return
+		}
+		if manifestFile != "" {
+			if err := WriteManifest(manifest, manifestFile); err != nil {
+				log.Println("An error occurred while writing the manifest: ", err)
+				return
 			}
+			log.Printf("Manifest written to %s: use `multipilot wait %s` to wait for the batch\n", manifestFile, manifestFile)
 		}
-		var failureReasons string
-		switch len(reasonsFailed) {
-		case 0:
-			failureReasons = "\n"
-		default:
-			failureReasons = "Failure reasons:\n- " + strings.Join(reasonsFailed, "\n- ") + "\n"
+		fmt.Print(FormatManifest(manifest))
+	},
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <manifest>",
+	Short: "Wait for a submitted batch of Copilot tasks",
+	Long:  "Wait for the batch described by a manifest written by `multipilot submit` to complete, and print its summary",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manifest, err := LoadManifest(args[0])
+		if err != nil {
+			log.Println("An error occurred while loading the manifest: ", err)
+			return
+		}
+		result, err := GetBatchResult(manifest.BatchID)
+		if err != nil {
+			log.Println("An error occurred while fetching the result of the batch: ", err)
+			return
+		}
+		if err := WriteComparisons(result); err != nil {
+			log.Println("An error occurred while writing the model comparisons: ", err)
+		}
+		fmt.Print(FormatSummary(result))
+	},
+}
+
+var resultCmd = &cobra.Command{
+	Use:   "result <workflow-id>",
+	Short: "Fetch the result of a batch of Copilot tasks",
+	Long:  "Fetch the aggregated result of a batch of Copilot tasks from its workflow ID, waiting for the batch to complete if it is still running",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := GetBatchResult(args[0])
+		if err != nil {
+			log.Println("An error occurred while fetching the result of the batch: ", err)
+			return
+		}
+		if err := WriteComparisons(result); err != nil {
+			log.Println("An error occurred while writing the model comparisons: ", err)
+		}
+		fmt.Print(FormatSummary(result))
+	},
+}
+
+var followUpTimeout int64
+
+var sendCmd = &cobra.Command{
+	Use:   "send <workflow-id> <prompt>",
+	Short: "Send a follow-up prompt to a running Copilot task",
+	Long:  "Send a follow-up prompt to the Copilot session of a running task, identified by its workflow ID. The reply is appended to the log file of the task.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := SendPromptToWorkflow(args[0], shared.CopilotTurn{Prompt: args[1], Timeout: followUpTimeout})
+		if err != nil {
+			log.Println("An error occurred while sending the prompt: ", err)
+			return
+		}
+		log.Printf("Prompt sent to workflow %s\n", args[0])
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <workflow-id>",
+	Short: "Show what a Copilot task or batch is currently doing",
+	Long:  "Show the current phase, last event, number of events, elapsed time and attempt number of a Copilot task, or the status of each task of a batch (pending, running, succeeded, failed or skipped), identified by its workflow ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workflowType, err := GetWorkflowType(args[0])
+		if err != nil {
+			log.Println("An error occurred while describing the workflow: ", err)
+			return
+		}
+		if workflowType == BatchWorkflowType {
+			status, err := GetBatchStatus(args[0])
+			if err != nil {
+				log.Println("An error occurred while fetching the status of the batch: ", err)
+				return
+			}
+			fmt.Print(FormatBatchStatus(status))
+			return
+		}
+		status, err := GetWorkflowStatus(args[0])
+		if err != nil {
+			log.Println("An error occurred while fetching the status of the task: ", err)
+			return
+		}
+		fmt.Print(FormatStatus(status))
+	},
+}
+
+var listFilter shared.WorkflowFilter
+var listSince string
+var listUntil string
+var listLimit int
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the Copilot tasks or batches known to Temporal",
+	Long:  "List the workflows of Copilot tasks, or of batches with --batches, from the Temporal visibility store, filtering them by status, start time, cwd and model",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		now := time.Now()
+		if listFilter.Since, err = ParseTimeFilter(listSince, now); err != nil {
+			log.Println("An error occurred while parsing --since: ", err)
+			return
+		}
+		if listFilter.Until, err = ParseTimeFilter(listUntil, now); err != nil {
+			log.Println("An error occurred while parsing --until: ", err)
+			return
+		}
+		summaries, err := ListWorkflows(listFilter, listLimit)
+		if err != nil {
+			log.Println("An error occurred while listing the workflows: ", err)
+			return
+		}
+		fmt.Print(FormatWorkflowList(summaries))
+	},
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe <workflow-id>",
+	Short: "Show the input, attempts, timings and result of a Copilot task or batch",
+	Long:  "Show the original input of a Copilot task or batch, with its token redacted, along with the attempts and timings of its activities and its result, identified by its workflow ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		description, err := DescribeWorkflow(args[0])
+		if err != nil {
+			log.Println("An error occurred while describing the workflow: ", err)
+			return
+		}
+		output, err := FormatDescription(description)
+		if err != nil {
+			log.Println("An error occurred while formatting the description of the workflow: ", err)
+			return
 		}
-		fmt.Printf("Successfull tasks: %d\nFailed tasks: %d\n%s", success, failed, failureReasons)
+		fmt.Print(output)
 	},
 }
 
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <workflow-id>",
+	Short: "Cancel a running Copilot task or batch",
+	Long:  "Cancel a running Copilot task or batch, identified by its workflow ID. The in-flight request of the session is aborted, the session is torn down and an abort event is written to the log file. Canceling a batch cancels its running tasks and skips the pending ones.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := CancelWorkflow(args[0]); err != nil {
+			log.Println("An error occurred while canceling the workflow: ", err)
+			return
+		}
+		log.Printf("Cancellation requested for workflow %s: use `multipilot status %s` to follow it\n", args[0], args[0])
+	},
+}
+
+var terminateReason string
+
+var terminateCmd = &cobra.Command{
+	Use:   "terminate <workflow-id>",
+	Short: "Terminate a Copilot task or batch right away",
+	Long:  "Terminate a Copilot task or batch, identified by its workflow ID, without waiting for it to clean up: use it when `multipilot cancel` does not stop it. The running sessions are torn down once their next heartbeat fails.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := TerminateWorkflow(args[0], terminateReason); err != nil {
+			log.Println("An error occurred while terminating the workflow: ", err)
+			return
+		}
+		log.Printf("Workflow %s terminated\n", args[0])
+	},
+}
+
+var retryCmd = &cobra.Command{
+	Use:   "retry <workflow-id>",
+	Short: "Run a completed, failed or canceled Copilot task or batch again",
+	Long:  "Run a Copilot task or batch that is no longer running again, under the same workflow ID and with the same input",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runId, err := RetryWorkflow(args[0])
+		if err != nil {
+			log.Println("An error occurred while retrying the workflow: ", err)
+			return
+		}
+		log.Printf("Workflow %s started again with Run ID %s: use `multipilot status %s` to follow it\n", args[0], runId, args[0])
+	},
+}
+
+var maxConcurrentActivities int
+
 var workerCmd = &cobra.Command{
 	Use:   "start-worker",
 	Short: "Start the Temporal worker responsible for the execution of Copilot tasks",
 	Long:  "Start the Temporal worker that, polling from the task queue, orchestrates the execution of Copilot tasks",
 	Run: func(cmd *cobra.Command, args []string) {
-		worker.StartWorker()
+		config, err := ResolveTemporalConfig(configFile, configFormat, temporalFlags)
+		if err != nil {
+			log.Fatalln("An error occurred while loading the Temporal connection settings: ", err)
+		}
+		worker.StartWorker(worker.Options{Temporal: config, MaxConcurrentActivities: maxConcurrentActivities})
 	},
 }
 
 var port int
+var comparisonToRender string
 var host string
 var fileToRender string
 
 var renderCmd = &cobra.Command{
 	Use:   "render",
 	Short: "Render logs from a MultiPilot session",
-	Long:  "Render the logs from a MultiPilot session within a HTML file served locally on your browser.",
+	Long:  "Render the logs from a MultiPilot session, or the sessions of a model comparison side by side, within a HTML file served locally on your browser.",
 	Run: func(cmd *cobra.Command, args []string) {
-		if fileToRender == "" {
-			log.Println("required option `--input/-i` is missing")
-			return
-		}
-		events, err := LoadEvents(fileToRender)
-		if err != nil {
-			log.Printf("An error occurred while loading the events from the log file: %s\n", err.Error())
+		var component templ.Component
+		switch {
+		case comparisonToRender != "":
+			comparison, err := LoadComparison(comparisonToRender)
+			if err != nil {
+				log.Printf("An error occurred while loading the model comparison: %s\n", err.Error())
+				return
+			}
+			events := make([][]shared.CopilotEvent, len(comparison.Runs))
+			diffs := make([]*string, len(comparison.Runs))
+			for i, run := range comparison.Runs {
+				// a run that failed early might not have any log file
+				if events[i], err = LoadEvents(run.LogFile); err != nil {
+					log.Printf("Unable to load the events of model %s: %s\n", run.Model, err.Error())
+				}
+				if diffs[i], err = LoadDiff(run.LogFile); err != nil {
+					log.Printf("Unable to load the diff of model %s: %s\n", run.Model, err.Error())
+				}
+			}
+			component = components.Compare(*comparison, events, diffs)
+		case fileToRender != "":
+			events, err := LoadEvents(fileToRender)
+			if err != nil {
+				log.Printf("An error occurred while loading the events from the log file: %s\n", err.Error())
+				return
+			}
+			diff, err := LoadDiff(fileToRender)
+			if err != nil {
+				log.Printf("An error occurred while loading the diff of the session: %s\n", err.Error())
+				return
+			}
+			component = components.Home(events, diff)
+		default:
+			log.Println("one of the options `--input/-i` or `--compare` is required")
 			return
 		}
 		addr := fmt.Sprintf("%s:%d", host, port)
 		server := http.NewServeMux()
-		component := components.Home(events)
 		server.Handle("GET /", templ.Handler(component))
 		log.Printf("starting server on :%s\n", addr)
 
@@ -118,14 +351,52 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&configFile, "config", "c", DefaultConfigFile, "Path to the JSON file where the config for multipilot is stored. Defaults to: multipilot.config.json")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", DefaultConfigFile, "Path to the JSON, YAML or TOML file where the config for multipilot is stored. Defaults to: multipilot.config.json")
+	rootCmd.PersistentFlags().StringVar(&configFormat, "format", "", "Format of the config file: json, yaml or toml. Defaults to the one matching the extension of the file, or json")
+	rootCmd.PersistentFlags().StringVar(&temporalFlags.Address, "temporal-address", "", "Address of the Temporal frontend (host:port). Defaults to $TEMPORAL_ADDRESS, the temporal section of the config, or localhost:7233")
+	rootCmd.PersistentFlags().StringVar(&temporalFlags.Namespace, "namespace", "", "Temporal namespace. Defaults to $TEMPORAL_NAMESPACE, the temporal section of the config, or default")
+	rootCmd.PersistentFlags().StringVar(&temporalFlags.TLSCert, "tls-cert", "", "Path to the client certificate for mTLS. Defaults to $TEMPORAL_TLS_CERT or the temporal section of the config")
+	rootCmd.PersistentFlags().StringVar(&temporalFlags.TLSKey, "tls-key", "", "Path to the client private key for mTLS. Defaults to $TEMPORAL_TLS_KEY or the temporal section of the config")
+	rootCmd.PersistentFlags().StringVar(&temporalFlags.APIKey, "api-key", "", "Temporal API key. Defaults to $TEMPORAL_API_KEY or the temporal section of the config")
 	rootCmd.Flags().BoolVarP(&showHelp, "help", "h", false, "Show the help message and exit.")
+	rootCmd.Flags().IntVarP(&maxParallel, "max-parallel", "m", 0, "Maximum number of tasks running at the same time, the others are pending. Defaults to the max_parallel of the config, or no limit")
+	rootCmd.Flags().BoolVar(&searchAttributes, "search-attributes", false, "Tag the workflow of each task with the MultipilotTaskName, MultipilotCwd and MultipilotModel search attributes, which must be registered on the namespace")
 
 	renderCmd.Flags().StringVarP(&fileToRender, "input", "i", "", "File with the JSON log records to render")
 	renderCmd.Flags().IntVarP(&port, "port", "p", 8000, "Port where to serve the rendered logs")
 	renderCmd.Flags().StringVarP(&host, "bind", "b", "0.0.0.0", "Host where to bind the port for logs rendering")
-	_ = renderCmd.MarkFlagRequired("input")
+	renderCmd.Flags().StringVar(&comparisonToRender, "compare", "", "Model comparison report to render side by side")
+	renderCmd.MarkFlagsMutuallyExclusive("input", "compare")
+
+	submitCmd.Flags().IntVarP(&maxParallel, "max-parallel", "m", 0, "Maximum number of tasks running at the same time, the others are pending. Defaults to the max_parallel of the config, or no limit")
+	submitCmd.Flags().BoolVar(&searchAttributes, "search-attributes", false, "Tag the workflow of each task with the MultipilotTaskName, MultipilotCwd and MultipilotModel search attributes, which must be registered on the namespace")
+	submitCmd.Flags().StringVarP(&manifestFile, "output", "o", "", "Path of the JSON manifest to write with the workflow IDs and log files of the tasks")
+
+	listCmd.Flags().StringVarP(&listFilter.Status, "status", "s", "", "Only list the workflows with this status: running, completed, failed, canceled, terminated or timed_out")
+	listCmd.Flags().StringVar(&listSince, "since", "", "Only list the workflows started after this time, as a RFC 3339 timestamp or a duration such as 24h")
+	listCmd.Flags().StringVar(&listUntil, "until", "", "Only list the workflows started before this time, as a RFC 3339 timestamp or a duration such as 24h")
+	listCmd.Flags().StringVar(&listFilter.Cwd, "cwd", "", "Only list the tasks running in this directory")
+	listCmd.Flags().StringVar(&listFilter.Model, "model", "", "Only list the tasks running with this model")
+	listCmd.Flags().BoolVar(&listFilter.Batches, "batches", false, "List the batches instead of the tasks")
+	listCmd.Flags().BoolVar(&listFilter.SearchAttributes, "search-attributes", false, "Filter the cwd and the model with the search attributes rather than the memo of the workflows")
+	listCmd.Flags().IntVarP(&listLimit, "limit", "n", 50, "Maximum number of workflows to list, 0 for no limit")
+
+	terminateCmd.Flags().StringVarP(&terminateReason, "reason", "r", "terminated with multipilot", "Reason of the termination, recorded in the workflow history")
+
+	workerCmd.Flags().IntVar(&maxConcurrentActivities, "max-concurrent-activities", 0, "Maximum number of Copilot sessions running at the same time on this worker. Defaults to the Temporal default")
+
+	sendCmd.Flags().Int64VarP(&followUpTimeout, "timeout", "t", 0, "Maximum duration in seconds for the follow-up turn. Defaults to the timeout of the task")
 
 	rootCmd.AddCommand(workerCmd)
 	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(resultCmd)
+	rootCmd.AddCommand(submitCmd)
+	rootCmd.AddCommand(waitCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(cancelCmd)
+	rootCmd.AddCommand(terminateCmd)
+	rootCmd.AddCommand(retryCmd)
 }
@@ -0,0 +1,47 @@
+package components
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AstraBert/multipilot/shared"
+)
+
+func TestCompareGridColumns(t *testing.T) {
+	testCases := []struct {
+		runs            int
+		expectedColumns string
+	}{
+		{runs: 1, expectedColumns: "grid grid-cols-1 gap-4"},
+		{runs: 2, expectedColumns: "grid grid-cols-1 lg:grid-cols-2 gap-4"},
+		{runs: 4, expectedColumns: "grid grid-cols-1 lg:grid-cols-3 gap-4"},
+	}
+	for _, tc := range testCases {
+		columns := compareGridColumns(tc.runs)
+		if columns != tc.expectedColumns {
+			t.Fatalf("Expected columns %s for %d runs, got %s", tc.expectedColumns, tc.runs, columns)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	patch := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package main\n+package app\n"
+	comparison := shared.ModelComparison{
+		Report: "refactor-comparison.json",
+		Runs: []shared.ModelRun{
+			{Model: "gpt-5", Status: shared.TaskSucceeded, LogFile: "refactor-gpt-5.jsonl", Additions: 1, Deletions: 1},
+			{Model: "gpt-4.1", Status: shared.TaskFailed, Error: "model is not available", LogFile: "refactor-gpt-4.1.jsonl"},
+		},
+	}
+	events := [][]shared.CopilotEvent{{{ID: "1", Type: "assistant.message"}}, nil}
+	var html strings.Builder
+	if err := Compare(comparison, events, []*string{&patch, nil}).Render(context.Background(), &html); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	for _, expected := range []string{"gpt-5", "gpt-4.1", "badge badge-success", "badge badge-error", "model is not available", "+package app", "No events recorded for this model."} {
+		if !strings.Contains(html.String(), expected) {
+			t.Fatalf("Expected the comparison to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package components
+
+import "testing"
+
+func TestDiffStats(t *testing.T) {
+	patch := "diff --git a/main.go b/main.go\nindex 8c3f1a2..4b1d9e0 100644\n--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,4 @@\n package main\n \n-func main() {}\n+func main() {\n+}\ndiff --git a/new.go b/new.go\nnew file mode 100644\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+package main\n"
+	files, additions, deletions := diffStats(patch)
+	if files != 2 || additions != 3 || deletions != 1 {
+		t.Fatalf("Expected 2 files, 3 additions and 1 deletion, got %d, %d and %d", files, additions, deletions)
+	}
+	if stats := diffStatsToString(""); stats != "0 file(s) changed, +0 -0" {
+		t.Fatalf("Expected empty stats for an empty patch, got %s", stats)
+	}
+}
+
+func TestDiffLineColor(t *testing.T) {
+	testCases := []struct {
+		line          string
+		expectedColor string
+	}{
+		{line: "+++ b/main.go", expectedColor: "text-gray-500 font-bold"},
+		{line: "--- a/main.go", expectedColor: "text-gray-500 font-bold"},
+		{line: "@@ -1,3 +1,4 @@", expectedColor: "text-blue-600 bg-blue-50"},
+		{line: "+func main() {", expectedColor: "text-green-800 bg-green-50"},
+		{line: "-func main() {}", expectedColor: "text-red-800 bg-red-50"},
+		{line: " package main", expectedColor: "text-gray-800"},
+	}
+	for _, tc := range testCases {
+		color := getDiffLineColor(tc.line)
+		if color != tc.expectedColor {
+			t.Fatalf("Expected %s for line %q, got %s", tc.expectedColor, tc.line, color)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatJSON string = "json"
+	FormatYAML string = "yaml"
+	FormatTOML string = "toml"
+)
+
+var yamlError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+var tomlError = regexp.MustCompile(`^toml: line (\d+)(?: \(last key "(.*)"\))?: (.*)$`)
+
+// ConfigFormat returns the given format if any, otherwise the one matching the
+// extension of the config file, JSON by default.
+func ConfigFormat(configFile, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatJSON, FormatYAML, FormatTOML:
+		return strings.ToLower(format), nil
+	case "yml":
+		return FormatYAML, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid format %s: expected one of json, yaml or toml", format)
+	}
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return FormatJSON, nil
+	}
+}
+
+// DecodeConfig decodes the content of a config file into v, reporting the file,
+// line and field the errors refer to.
+func DecodeConfig(configFile string, content []byte, format string, v any) error {
+	switch format {
+	case FormatYAML:
+		return decodeYAML(configFile, content, v)
+	case FormatTOML:
+		return decodeTOML(configFile, content, v)
+	default:
+		return decodeJSON(configFile, content, v)
+	}
+}
+
+func configError(configFile string, line int, field, message string) error {
+	if field == "" {
+		return fmt.Errorf("%s:%d: %s", configFile, line, message)
+	}
+	return fmt.Errorf("%s:%d: %s: %s", configFile, line, field, message)
+}
+
+func decodeJSON(configFile string, content []byte, v any) error {
+	err := json.Unmarshal(content, v)
+	line := func(offset int64) int {
+		return bytes.Count(content[:min(int(offset), len(content))], []byte("\n")) + 1
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return configError(configFile, line(syntaxErr.Offset), "", syntaxErr.Error())
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return configError(configFile, line(typeErr.Offset), jsonField(typeErr.Field), fmt.Sprintf("cannot unmarshal %s into %s", typeErr.Value, typeErr.Type))
+	}
+	return err
+}
+
+// jsonField writes the indexes of a field path the same way as yamlField.
+func jsonField(field string) string {
+	var path strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			fmt.Fprintf(&path, "[%s]", part)
+			continue
+		}
+		if i > 0 {
+			path.WriteString(".")
+		}
+		path.WriteString(part)
+	}
+	return path.String()
+}
+
+func decodeYAML(configFile string, content []byte, v any) error {
+	err := yaml.Unmarshal(content, v)
+	if err == nil {
+		return nil
+	}
+	var root yaml.Node
+	// the tree is empty on a syntax error, in which case no field is reported
+	_ = yaml.Unmarshal(content, &root)
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	errs := []error{}
+	for _, message := range messages {
+		match := yamlError.FindStringSubmatch(strings.TrimSpace(message))
+		if match == nil {
+			errs = append(errs, fmt.Errorf("%s: %s", configFile, message))
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		errs = append(errs, configError(configFile, line, yamlField(&root, line, ""), match[2]))
+	}
+	return errors.Join(errs...)
+}
+
+// yamlField returns the path of the innermost field defined at the given line.
+func yamlField(node *yaml.Node, line int, path string) string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if field := yamlField(child, line, path); field != "" {
+				return field
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field := key.Value
+			if path != "" {
+				field = path + "." + key.Value
+			}
+			if nested := yamlField(value, line, field); nested != "" {
+				return nested
+			}
+			if key.Line == line || value.Line == line {
+				return field
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			field := fmt.Sprintf("%s[%d]", path, i)
+			if nested := yamlField(child, line, field); nested != "" {
+				return nested
+			}
+			if child.Line == line {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+func decodeTOML(configFile string, content []byte, v any) error {
+	_, err := toml.Decode(string(content), v)
+	if err == nil {
+		return nil
+	}
+	match := tomlError.FindStringSubmatch(err.Error())
+	if match == nil {
+		return fmt.Errorf("%s: %s", configFile, err.Error())
+	}
+	line, _ := strconv.Atoi(match[1])
+	return configError(configFile, line, match[2], match[3])
+}
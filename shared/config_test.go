@@ -0,0 +1,101 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestConfigFormat(t *testing.T) {
+	testCases := []struct {
+		configFile    string
+		format        string
+		expected      string
+		expectedError string
+	}{
+		{configFile: "multipilot.config.json", expected: FormatJSON},
+		{configFile: "tasks.yaml", expected: FormatYAML},
+		{configFile: "tasks.YML", expected: FormatYAML},
+		{configFile: "tasks.toml", expected: FormatTOML},
+		{configFile: "tasks.txt", expected: FormatJSON},
+		{configFile: "tasks.txt", format: "yml", expected: FormatYAML},
+		{configFile: "tasks.json", format: "TOML", expected: FormatTOML},
+		{configFile: "tasks.json", format: "ini", expectedError: "invalid format ini: expected one of json, yaml or toml"},
+	}
+	for _, tc := range testCases {
+		format, err := ConfigFormat(tc.configFile, tc.format)
+		if tc.expectedError != "" {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		if format != tc.expected {
+			t.Fatalf("Expected format %s for %s (%q), got %s", tc.expected, tc.configFile, tc.format, format)
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		format        string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "json syntax",
+			format:        FormatJSON,
+			content:       "{\n  \"tasks\": [\n    {\"prompt\": \"hello\",}\n  ]\n}",
+			expectedError: "tasks.json:3: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			name:          "json type",
+			format:        FormatJSON,
+			content:       "{\n  \"max_parallel\": 2,\n  \"tasks\": [\n    {\"timeout_sec\": \"300\"}\n  ]\n}",
+			expectedError: "tasks.json:4: tasks[0].timeout_sec: cannot unmarshal string into int64",
+		},
+		{
+			name:          "yaml syntax",
+			format:        FormatYAML,
+			content:       "tasks:\n  - prompt: a: b\n",
+			expectedError: "tasks.json:2: mapping values are not allowed in this context",
+		},
+		{
+			name:          "yaml types",
+			format:        FormatYAML,
+			content:       "max_parallel: two\ntasks:\n  - prompt: hello\n    git:\n      allow_dirty: maybe\n",
+			expectedError: "tasks.json:1: max_parallel: cannot unmarshal !!str `two` into int\ntasks.json:5: tasks[0].git.allow_dirty: cannot unmarshal !!str `maybe` into bool",
+		},
+		{
+			name:          "toml syntax",
+			format:        FormatTOML,
+			content:       "max_parallel = 2\n\n[[tasks]]\nprompt = hello\n",
+			expectedError: "tasks.json:4: tasks.prompt: expected value but found \"hello\" instead",
+		},
+		{
+			name:    "valid yaml",
+			format:  FormatYAML,
+			content: "# comment\ntasks:\n  - prompt: |\n      multi\n      line\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tasks CopilotTasks
+			err := DecodeConfig("tasks.json", []byte(tc.content), tc.format, &tasks)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Not expecting an error, got %s", err.Error())
+				}
+				if tasks.Tasks[0].Prompt != "multi\nline\n" {
+					t.Fatalf("Expected a multi-line prompt, got %q", tasks.Tasks[0].Prompt)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
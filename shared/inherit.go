@@ -0,0 +1,209 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// notInherited lists the fields identifying a task within the batch, which are
+// never taken from the defaults or from a profile.
+var notInherited = []string{"id", "depends_on", "extends", "override", "comparison"}
+
+// alternativeFields maps the fields that cannot be used together: setting one
+// of them in a task stops the others from being inherited.
+var alternativeFields = map[string][]string{
+	"ai_model":           {"ai_models"},
+	"ai_models":          {"ai_model"},
+	"prompt":             {"prompts", "prompt_file"},
+	"prompts":            {"prompt", "prompt_file"},
+	"prompt_file":        {"prompt", "prompts"},
+	"system_prompt":      {"system_prompt_file"},
+	"system_prompt_file": {"system_prompt"},
+}
+
+// FieldsSet holds the fields each task, profile and the defaults set in the
+// config file, decoded as generic maps, so that a value set on purpose to false
+// or 0 is not taken for a missing one.
+type FieldsSet struct {
+	Defaults map[string]any            `json:"defaults" yaml:"defaults" toml:"defaults"`
+	Profiles map[string]map[string]any `json:"profiles" yaml:"profiles" toml:"profiles"`
+	Tasks    []map[string]any          `json:"tasks" yaml:"tasks" toml:"tasks"`
+}
+
+// presence tells whether the fields of a struct are set: without a config file
+// to look at, only the fields that are not zero are.
+type presence struct {
+	tracked bool
+	fields  map[string]any
+}
+
+func (p presence) has(name string, v reflect.Value) bool {
+	if !p.tracked {
+		return !v.IsZero()
+	}
+	_, ok := p.fields[name]
+	return ok
+}
+
+func (p presence) child(name string) presence {
+	fields, _ := p.fields[name].(map[string]any)
+	return presence{tracked: p.tracked, fields: fields}
+}
+
+// Inherit merges the defaults, then the profiles each task extends in order,
+// into the tasks. Values set by a task win over inherited ones, except for lists,
+// which are appended to the inherited ones, and maps, which are merged with them,
+// unless the task lists the field in override. fields tells which values are set
+// in the config file; when it is nil, the values that are not zero are.
+func (t *CopilotTasks) Inherit(fields *FieldsSet) error {
+	tracked := fields != nil
+	if !tracked {
+		fields = &FieldsSet{}
+	}
+	layerFields := func(set map[string]any) presence {
+		return presence{tracked: tracked, fields: set}
+	}
+	layers := []CopilotInput{}
+	layersFields := []presence{}
+	if t.Defaults != nil {
+		if len(t.Defaults.Extends) > 0 {
+			return errors.New("defaults cannot extend profiles")
+		}
+		if err := checkOverride("defaults", *t.Defaults); err != nil {
+			return err
+		}
+		layers = append(layers, *t.Defaults)
+		layersFields = append(layersFields, layerFields(fields.Defaults))
+	}
+	for name, profile := range t.Profiles {
+		if len(profile.Extends) > 0 {
+			return fmt.Errorf("profile %s cannot extend other profiles", name)
+		}
+		if err := checkOverride("profile "+name, profile); err != nil {
+			return err
+		}
+	}
+	for i, task := range t.Tasks {
+		if err := checkOverride("task "+task.GetName(), task); err != nil {
+			return err
+		}
+		merged := CopilotInput{}
+		for j, layer := range layers {
+			merged = mergeTask(layer, merged, layersFields[j])
+		}
+		for _, name := range task.Extends {
+			profile, ok := t.Profiles[name]
+			if !ok {
+				return fmt.Errorf("task %s extends unknown profile %s", task.GetName(), name)
+			}
+			merged = mergeTask(profile, merged, layerFields(fields.Profiles[name]))
+		}
+		var taskFields map[string]any
+		if i < len(fields.Tasks) {
+			taskFields = fields.Tasks[i]
+		}
+		t.Tasks[i] = mergeTask(task, merged, layerFields(taskFields))
+	}
+	t.Defaults = nil
+	t.Profiles = nil
+	return nil
+}
+
+func checkOverride(label string, c CopilotInput) error {
+	fields := reflect.TypeOf(c)
+	for _, name := range c.Override {
+		if _, ok := fieldIndex(fields, name); !ok || slices.Contains(notInherited, name) {
+			return fmt.Errorf("%s cannot override unknown field %s", label, name)
+		}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+func fieldIndex(fields reflect.Type, name string) (int, bool) {
+	for i := range fields.NumField() {
+		if fieldName(fields.Field(i)) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// mergeTask returns over with the values it does not set taken from base.
+func mergeTask(over, base CopilotInput, fields presence) CopilotInput {
+	merged := over
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(base)
+	skipped := append(slices.Clone(notInherited), over.Override...)
+	for name, alternatives := range alternativeFields {
+		if i, _ := fieldIndex(dst.Type(), name); !dst.Field(i).IsZero() {
+			skipped = append(skipped, alternatives...)
+		}
+	}
+	for i := range dst.NumField() {
+		name := fieldName(dst.Type().Field(i))
+		if slices.Contains(skipped, name) {
+			continue
+		}
+		mergeValue(dst.Field(i), src.Field(i), fields.has(name, dst.Field(i)), fields.child(name))
+	}
+	return merged
+}
+
+// mergeValue fills dst with src, unless set tells that dst is set, without ever
+// modifying the values dst or src point to, since they can be shared with other
+// tasks. The fields of a struct are merged one by one, as told by fields.
+func mergeValue(dst, src reflect.Value, set bool, fields presence) {
+	switch dst.Kind() {
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		merged := reflect.MakeSlice(dst.Type(), 0, src.Len()+dst.Len())
+		dst.Set(reflect.AppendSlice(reflect.AppendSlice(merged, src), dst))
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		merged := reflect.MakeMapWithSize(dst.Type(), src.Len()+dst.Len())
+		for _, m := range []reflect.Value{src, dst} {
+			iter := m.MapRange()
+			for iter.Next() {
+				merged.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		dst.Set(merged)
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		merged := reflect.New(dst.Type().Elem())
+		switch {
+		case dst.IsNil() && !set:
+			merged.Elem().Set(src.Elem())
+		case dst.IsNil() || dst.Elem().Kind() != reflect.Struct:
+			// a pointer to a scalar, such as max_iterations, is set on purpose
+			return
+		default:
+			merged.Elem().Set(dst.Elem())
+			mergeValue(merged.Elem(), src.Elem(), set, fields)
+		}
+		dst.Set(merged)
+	case reflect.Struct:
+		for i := range dst.NumField() {
+			name := fieldName(dst.Type().Field(i))
+			mergeValue(dst.Field(i), src.Field(i), fields.has(name, dst.Field(i)), fields.child(name))
+		}
+	default:
+		if !set {
+			dst.Set(src)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+func TestInherit(t *testing.T) {
+	defaultRetry := &RetryConfig{MaxAttempts: 3, NonRetryableErrorTypes: []string{AuthenticationError}}
+	carefulRetry := &RetryConfig{InitialInterval: 5}
+	tasks := CopilotTasks{
+		Defaults: &CopilotInput{
+			GitHubToken:  "$GITHUB_TOKEN",
+			AiModel:      "gpt-5",
+			LogLevel:     "info",
+			ExcludeTools: []string{"shell(rm)"},
+			Vars:         map[string]string{"language": "Go", "focus": "tests"},
+			Retry:        defaultRetry,
+		},
+		Profiles: map[string]CopilotInput{
+			"mcp": {
+				LocalMcpServers: map[string]copilot.MCPLocalServerConfig{"fs": {Command: "mcp-fs"}},
+				ExcludeTools:    []string{"shell(git push)"},
+			},
+			"careful": {
+				LogLevel: "debug",
+				Retry:    carefulRetry,
+			},
+		},
+		Tasks: []CopilotInput{
+			{
+				ID:           "review",
+				LogFile:      "review.jsonl",
+				Extends:      []string{"mcp", "careful"},
+				ExcludeTools: []string{"write"},
+				Vars:         map[string]string{"focus": "errors"},
+			},
+			{
+				ID:           "compare",
+				LogFile:      "compare.jsonl",
+				DependsOn:    []string{"review"},
+				AiModels:     []string{"gpt-4.1", "claude-sonnet-4.5"},
+				ExcludeTools: []string{"write"},
+				Vars:         map[string]string{"focus": "errors"},
+				Override:     []string{"exclude_tools", "vars", "retry"},
+			},
+		},
+	}
+	if err := tasks.Inherit(nil); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if tasks.Defaults != nil || tasks.Profiles != nil {
+		t.Fatal("Expected the defaults and profiles to be dropped once inherited")
+	}
+	review := tasks.Tasks[0]
+	if review.GitHubToken != "$GITHUB_TOKEN" || review.AiModel != "gpt-5" || review.LogLevel != "debug" || review.ID != "review" {
+		t.Fatalf("Expected the scalar values to be inherited, got %+v", review)
+	}
+	if !reflect.DeepEqual(review.ExcludeTools, []string{"shell(rm)", "shell(git push)", "write"}) {
+		t.Fatalf("Expected the excluded tools to be appended, got %v", review.ExcludeTools)
+	}
+	if !reflect.DeepEqual(review.Vars, map[string]string{"language": "Go", "focus": "errors"}) {
+		t.Fatalf("Expected the vars to be merged, got %v", review.Vars)
+	}
+	if _, ok := review.LocalMcpServers["fs"]; !ok {
+		t.Fatalf("Expected the MCP servers of the profile to be inherited, got %v", review.LocalMcpServers)
+	}
+	if review.Retry == nil || review.Retry.MaxAttempts != 3 || review.Retry.InitialInterval != 5 {
+		t.Fatalf("Expected the retry policies to be merged, got %+v", review.Retry)
+	}
+	compare := tasks.Tasks[1]
+	if compare.AiModel != "" || len(compare.AiModels) != 2 {
+		t.Fatalf("Expected ai_model not to be inherited by a task with ai_models, got %s", compare.AiModel)
+	}
+	if !reflect.DeepEqual(compare.ExcludeTools, []string{"write"}) || !reflect.DeepEqual(compare.Vars, map[string]string{"focus": "errors"}) || compare.Retry != nil {
+		t.Fatalf("Expected the overridden fields not to be inherited, got %v, %v and %+v", compare.ExcludeTools, compare.Vars, compare.Retry)
+	}
+	if compare.LogLevel != "info" || compare.LocalMcpServers != nil || !reflect.DeepEqual(compare.DependsOn, []string{"review"}) {
+		t.Fatalf("Expected only the defaults to be inherited, got %+v", compare)
+	}
+	if carefulRetry.MaxAttempts != 0 || defaultRetry.InitialInterval != 0 {
+		t.Fatalf("Expected the defaults and profiles not to be modified by the merge, got %+v and %+v", defaultRetry, carefulRetry)
+	}
+}
+
+func TestInheritExplicitValues(t *testing.T) {
+	tasks := CopilotTasks{
+		Defaults: &CopilotInput{Verify: &VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(3)}},
+		Tasks:    []CopilotInput{{LogFile: "review.jsonl", Verify: &VerifyConfig{MaxIterations: intPtr(0)}}},
+	}
+	if err := tasks.Inherit(nil); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if verify := tasks.Tasks[0].Verify; verify.Command != "go test ./..." || *verify.MaxIterations != 0 {
+		t.Fatalf("Expected max_iterations 0 to win over the defaults, got %+v", verify)
+	}
+
+	testCases := []struct {
+		format  string
+		content string
+	}{
+		{
+			format: FormatYAML,
+			content: `defaults:
+  verify: {command: go test ./..., max_iterations: 3, fail_on_error: true}
+  git: {branch: review, allow_dirty: true}
+tasks:
+  - log_file: explicit.jsonl
+    verify: {max_iterations: 0, fail_on_error: false}
+    git: {allow_dirty: false}
+  - log_file: inherited.jsonl
+`,
+		},
+		{
+			format: FormatTOML,
+			content: `[defaults.verify]
+command = "go test ./..."
+max_iterations = 3
+fail_on_error = true
+
+[defaults.git]
+branch = "review"
+allow_dirty = true
+
+[[tasks]]
+log_file = "explicit.jsonl"
+verify = {max_iterations = 0, fail_on_error = false}
+git = {allow_dirty = false}
+
+[[tasks]]
+log_file = "inherited.jsonl"
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var tasks CopilotTasks
+			var fields FieldsSet
+			for _, v := range []any{&tasks, &fields} {
+				if err := DecodeConfig("config."+tc.format, []byte(tc.content), tc.format, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tasks.Inherit(&fields); err != nil {
+				t.Fatalf("Not expecting an error, got %s", err.Error())
+			}
+			explicit, inherited := tasks.Tasks[0], tasks.Tasks[1]
+			if explicit.Verify.Command != "go test ./..." || *explicit.Verify.MaxIterations != 0 || explicit.Verify.FailOnError || explicit.Git.Branch != "review" || explicit.Git.AllowDirty {
+				t.Fatalf("Expected the values set to false or 0 to win over the defaults, got %+v and %+v", explicit.Verify, explicit.Git)
+			}
+			if *inherited.Verify.MaxIterations != 3 || !inherited.Verify.FailOnError || !inherited.Git.AllowDirty {
+				t.Fatalf("Expected the defaults to be inherited, got %+v and %+v", inherited.Verify, inherited.Git)
+			}
+		})
+	}
+}
+
+func TestInheritErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tasks         CopilotTasks
+		expectedError string
+	}{
+		{
+			name:          "unknown profile",
+			tasks:         CopilotTasks{Tasks: []CopilotInput{{ID: "review", Extends: []string{"mcp"}}}},
+			expectedError: "task review extends unknown profile mcp",
+		},
+		{
+			name: "nested profiles",
+			tasks: CopilotTasks{
+				Profiles: map[string]CopilotInput{"mcp": {Extends: []string{"careful"}}},
+				Tasks:    []CopilotInput{{ID: "review"}},
+			},
+			expectedError: "profile mcp cannot extend other profiles",
+		},
+		{
+			name:          "defaults extending a profile",
+			tasks:         CopilotTasks{Defaults: &CopilotInput{Extends: []string{"mcp"}}},
+			expectedError: "defaults cannot extend profiles",
+		},
+		{
+			name:          "unknown override",
+			tasks:         CopilotTasks{Tasks: []CopilotInput{{LogFile: "review.jsonl", Override: []string{"tools"}}}},
+			expectedError: "task review.jsonl cannot override unknown field tools",
+		},
+		{
+			name:          "override of a field that is never inherited",
+			tasks:         CopilotTasks{Defaults: &CopilotInput{Override: []string{"depends_on"}}},
+			expectedError: "defaults cannot override unknown field depends_on",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.tasks.Inherit(nil)
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// variablePattern matches ${VAR} and ${VAR:-default}, and their escaped form
+// $${VAR}, which is kept as a literal ${VAR}.
+var variablePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// notInterpolated lists the fields that are not expanded when the configuration
+// is loaded: prompts are free text, which can mention ${VAR} or start with file:,
+// and commands are expanded by the shell.
+var notInterpolated = map[reflect.Type][]string{
+	reflect.TypeFor[CopilotInput](): {"Prompt", "SystemPrompt", "Vars"},
+	reflect.TypeFor[CopilotTurn]():  {"Prompt"},
+	reflect.TypeFor[HookConfig]():   {"Command"},
+	reflect.TypeFor[VerifyConfig](): {"Command"},
+}
+
+// secretFields lists the fields that are likely to hold secrets: they are only
+// expanded by the worker, with ResolveSecrets, so that the secrets do not end up
+// in the workflow history.
+var secretFields = map[reflect.Type][]string{
+	reflect.TypeFor[CopilotInput]():                  {"GitHubToken", "Env"},
+	reflect.TypeFor[copilot.MCPLocalServerConfig]():  {"Env"},
+	reflect.TypeFor[copilot.MCPRemoteServerConfig](): {"URL", "Headers"},
+}
+
+// expandVariables replaces the environment variables within value, returning
+// value as is along with the names of the variables that are not set, if any.
+func expandVariables(value string) (string, []string) {
+	missing := []string{}
+	expanded := variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		groups := variablePattern.FindStringSubmatch(match)
+		if val, ok := os.LookupEnv(groups[1]); ok && (val != "" || groups[2] == "") {
+			return val
+		}
+		if groups[2] != "" {
+			return strings.TrimPrefix(groups[2], ":-")
+		}
+		missing = append(missing, groups[1])
+		return match
+	})
+	if len(missing) > 0 {
+		return value, missing
+	}
+	return expanded, nil
+}
+
+// expandValue replaces the environment variables within value, then reads the
+// file it references if it starts with file:, relative paths being resolved
+// against baseDir. The names of the variables that are not set are returned.
+func expandValue(value, baseDir string) (string, []string, error) {
+	expanded, missing := expandVariables(value)
+	if len(missing) > 0 {
+		return value, missing, nil
+	}
+	path, ok := strings.CutPrefix(expanded, "file:")
+	if !ok {
+		return expanded, nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil, nil
+}
+
+// Interpolate expands the environment variables and file references within the
+// string fields of the tasks, reporting every variable that is not set at once.
+// The fields holding secrets are left to the worker, and only their relative
+// file references are resolved, since the worker does not know where the config
+// is, but the variables they reference are checked all the same.
+func (t *CopilotTasks) Interpolate(baseDir string) error {
+	abs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	in := interpolation{baseDir: abs, skipSecrets: true}
+	for i, task := range t.Tasks {
+		t.Tasks[i] = in.value(reflect.ValueOf(task), fmt.Sprintf("tasks[%d]", i)).Interface().(CopilotInput)
+	}
+	return in.err()
+}
+
+// ResolveSecrets expands the environment variables and file references within
+// the fields holding secrets, apart from the token, which GetToken resolves.
+func (c CopilotInput) ResolveSecrets() (CopilotInput, error) {
+	in := interpolation{}
+	c.Env = in.env(c.Env, "env")
+	if c.LocalMcpServers != nil {
+		servers := make(map[string]copilot.MCPLocalServerConfig, len(c.LocalMcpServers))
+		for _, name := range slices.Sorted(maps.Keys(c.LocalMcpServers)) {
+			server := c.LocalMcpServers[name]
+			server.Env = in.value(reflect.ValueOf(server.Env), "local_mcp_servers."+name+".env").Interface().(map[string]string)
+			servers[name] = server
+		}
+		c.LocalMcpServers = servers
+	}
+	if c.RemoteMcpServers != nil {
+		servers := make(map[string]copilot.MCPRemoteServerConfig, len(c.RemoteMcpServers))
+		for _, name := range slices.Sorted(maps.Keys(c.RemoteMcpServers)) {
+			server := c.RemoteMcpServers[name]
+			server.URL = in.value(reflect.ValueOf(server.URL), "remote_mcp_servers."+name+".url").String()
+			server.Headers = in.value(reflect.ValueOf(server.Headers), "remote_mcp_servers."+name+".headers").Interface().(map[string]string)
+			servers[name] = server
+		}
+		c.RemoteMcpServers = servers
+	}
+	return c, in.err()
+}
+
+type interpolation struct {
+	baseDir     string
+	skipSecrets bool
+	missing     []string
+	errs        []error
+}
+
+func (in *interpolation) err() error {
+	errs := in.errs
+	if len(in.missing) > 0 {
+		errs = append([]error{fmt.Errorf("unresolved environment variables: %s", strings.Join(in.missing, ", "))}, errs...)
+	}
+	return errors.Join(errs...)
+}
+
+// value returns an expanded copy of v, without modifying the values v points
+// to, since they can be shared with other tasks.
+func (in *interpolation) value(v reflect.Value, path string) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, missing, err := expandValue(v.String(), in.baseDir)
+		for _, name := range missing {
+			in.missing = append(in.missing, fmt.Sprintf("%s (%s)", name, path))
+		}
+		if err != nil {
+			in.errs = append(in.errs, fmt.Errorf("%s: %w", path, err))
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(expanded)
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			out.Index(i).Set(in.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range sortedKeys(v) {
+			out.SetMapIndex(key, in.value(v.MapIndex(key), fmt.Sprintf("%s.%v", path, key)))
+		}
+		return out
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(in.value(v.Elem(), path))
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() || slices.Contains(notInterpolated[v.Type()], field.Name) {
+				continue
+			}
+			name := fieldName(field)
+			if name == "" {
+				name = field.Name
+			}
+			if in.skipSecrets && slices.Contains(secretFields[v.Type()], field.Name) {
+				in.checkVariables(v.Field(i), path+"."+name)
+				out.Field(i).Set(in.absoluteFiles(v.Field(i), field.Type == reflect.TypeFor[[]string]()))
+				continue
+			}
+			out.Field(i).Set(in.value(v.Field(i), path+"."+name))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of a map sorted, so that unresolved variables are
+// always reported in the same order.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	})
+	return keys
+}
+
+// checkVariables records the variables that are not set within v, a string, or
+// a list or a map of strings, without expanding them, so that the secrets are
+// only read by the worker.
+func (in *interpolation) checkVariables(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.String:
+		_, missing := expandVariables(v.String())
+		for _, name := range missing {
+			in.missing = append(in.missing, fmt.Sprintf("%s (%s)", name, path))
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			in.checkVariables(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(v) {
+			in.checkVariables(v.MapIndex(key), fmt.Sprintf("%s.%v", path, key))
+		}
+	}
+}
+
+// env expands the values of KEY=VALUE entries, so that a value can reference a
+// file as well.
+func (in *interpolation) env(entries []string, path string) []string {
+	if entries == nil {
+		return nil
+	}
+	out := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		entryPath := fmt.Sprintf("%s[%d]", path, i)
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			out = append(out, in.value(reflect.ValueOf(entry), entryPath).String())
+			continue
+		}
+		out = append(out, key+"="+in.value(reflect.ValueOf(value), entryPath).String())
+	}
+	return out
+}
+
+// absoluteFiles returns a copy of v, a string, or a list or a map of strings,
+// where the relative file references are resolved against baseDir. Entries of
+// a list are KEY=VALUE pairs.
+func (in *interpolation) absoluteFiles(v reflect.Value, entries bool) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(in.absoluteFile(v.String(), entries))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			out.Index(i).Set(in.absoluteFiles(v.Index(i), entries))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), in.absoluteFiles(iter.Value(), false))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func (in *interpolation) absoluteFile(value string, entry bool) string {
+	prefix := ""
+	if key, val, ok := strings.Cut(value, "="); entry && ok {
+		prefix, value = key+"=", val
+	}
+	path, ok := strings.CutPrefix(value, "file:")
+	// a path starting with a variable is resolved as is by the worker
+	if !ok || filepath.IsAbs(path) || strings.HasPrefix(path, "$") {
+		return prefix + value
+	}
+	return prefix + "file:" + filepath.Join(in.baseDir, path)
+}
@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+func TestExpandValue(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(baseDir, "api-key"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MULTIPILOT_SRC", "/home/user/src")
+	t.Setenv("MULTIPILOT_EMPTY", "")
+	t.Setenv("MULTIPILOT_SECRETS", baseDir)
+	testCases := []struct {
+		value           string
+		expected        string
+		expectedMissing []string
+		expectedError   bool
+	}{
+		{value: "plain value", expected: "plain value"},
+		{value: "${MULTIPILOT_SRC}/backend", expected: "/home/user/src/backend"},
+		{value: "$MULTIPILOT_SRC/backend", expected: "$MULTIPILOT_SRC/backend"},
+		{value: "${MULTIPILOT_UNSET:-gpt-5}", expected: "gpt-5"},
+		{value: "${MULTIPILOT_EMPTY:-gpt-5}", expected: "gpt-5"},
+		{value: "${MULTIPILOT_EMPTY}", expected: ""},
+		{value: "$${MULTIPILOT_SRC} is kept", expected: "${MULTIPILOT_SRC} is kept"},
+		{value: "${MULTIPILOT_UNSET}/${MULTIPILOT_SRC}/${MULTIPILOT_OTHER}", expected: "${MULTIPILOT_UNSET}/${MULTIPILOT_SRC}/${MULTIPILOT_OTHER}", expectedMissing: []string{"MULTIPILOT_UNSET", "MULTIPILOT_OTHER"}},
+		{value: "file:api-key", expected: "s3cr3t"},
+		{value: "file:${MULTIPILOT_SECRETS}/api-key", expected: "s3cr3t"},
+		{value: "file:unknown", expectedError: true},
+	}
+	for _, tc := range testCases {
+		expanded, missing, err := expandValue(tc.value, baseDir)
+		if tc.expectedError {
+			if err == nil {
+				t.Fatalf("Expected an error when expanding %s, got none", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Not expecting an error when expanding %s, got %s", tc.value, err.Error())
+		}
+		if expanded != tc.expected || !slices.Equal(missing, tc.expectedMissing) {
+			t.Fatalf("Expected %s to expand to %q with missing variables %v, got %q and %v", tc.value, tc.expected, tc.expectedMissing, expanded, missing)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("MULTIPILOT_SRC", "/home/user/src")
+	t.Setenv("MULTIPILOT_DOCS_URL", "https://docs.example.com/mcp")
+	t.Setenv("MULTIPILOT_API_KEY", "supersecret")
+	tasks := CopilotTasks{
+		Tasks: []CopilotInput{
+			{
+				LogFile:          "review.jsonl",
+				Cwd:              "${MULTIPILOT_SRC}/backend",
+				GitHubToken:      "file:secrets/token",
+				Env:              []string{"KEY=${MULTIPILOT_API_KEY}", "API_KEY=file:api-key", "SECRET=file:${MULTIPILOT_SRC}/secret"},
+				LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{"fs": {Command: "${MULTIPILOT_SRC}/bin/mcp-fs", Env: map[string]string{"KEY": "${MULTIPILOT_API_KEY}"}}},
+				RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{"docs": {URL: "${MULTIPILOT_DOCS_URL}", Headers: map[string]string{"Authorization": "file:api-key"}}},
+				PostHooks:        []HookConfig{{Command: "go test ${PKG}"}},
+				Git:              &GitConfig{Branch: "review/${MULTIPILOT_BRANCH:-main}"},
+			},
+		},
+	}
+	if err := tasks.Interpolate(baseDir); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	task := tasks.Tasks[0]
+	if task.Cwd != "/home/user/src/backend" || task.LocalMcpServers["fs"].Command != "/home/user/src/bin/mcp-fs" || task.Git.Branch != "review/main" {
+		t.Fatalf("Expected the string fields to be expanded, got %+v", task)
+	}
+	if task.PostHooks[0].Command != "go test ${PKG}" {
+		t.Fatalf("Expected the commands to be left to the shell, got %s", task.PostHooks[0].Command)
+	}
+	expectedEnv := []string{"KEY=${MULTIPILOT_API_KEY}", "API_KEY=file:" + filepath.Join(baseDir, "api-key"), "SECRET=file:${MULTIPILOT_SRC}/secret"}
+	if !slices.Equal(task.Env, expectedEnv) || task.LocalMcpServers["fs"].Env["KEY"] != "${MULTIPILOT_API_KEY}" || task.RemoteMcpServers["docs"].URL != "${MULTIPILOT_DOCS_URL}" {
+		t.Fatalf("Expected the secrets to be left to the worker, got %v, %v and %v", task.Env, task.LocalMcpServers, task.RemoteMcpServers)
+	}
+	if task.RemoteMcpServers["docs"].Headers["Authorization"] != "file:"+filepath.Join(baseDir, "api-key") || task.GitHubToken != "file:"+filepath.Join(baseDir, "secrets", "token") {
+		t.Fatalf("Expected the secret files to be resolved against the config directory, got %s and %s", task.RemoteMcpServers["docs"].Headers["Authorization"], task.GitHubToken)
+	}
+	if redacted := task.Redacted(); slices.Contains(redacted.Env, "KEY=supersecret") {
+		t.Fatalf("Expected no secret within the task, got %v", redacted.Env)
+	}
+
+	tasks = CopilotTasks{
+		Tasks: []CopilotInput{
+			{LogFile: "a.jsonl", Cwd: "${MULTIPILOT_UNSET}", LocalMcpServers: map[string]copilot.MCPLocalServerConfig{"fs": {Command: "${MULTIPILOT_BIN}/mcp-fs", Env: map[string]string{"ROOT": "${MULTIPILOT_ROOT}"}}}},
+			{LogFile: "b.jsonl", Cwd: "/src", Skills: []string{"file:missing"}},
+		},
+	}
+	expectedError := "unresolved environment variables: MULTIPILOT_UNSET (tasks[0].cwd), MULTIPILOT_BIN (tasks[0].local_mcp_servers.fs.command), MULTIPILOT_ROOT (tasks[0].local_mcp_servers.fs.env.ROOT)\ntasks[1].skills[0]: open " + filepath.Join(baseDir, "missing") + ": no such file or directory"
+	if err := tasks.Interpolate(baseDir); err == nil || err.Error() != expectedError {
+		t.Fatalf("Expected error %q, got %v", expectedError, err)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	secretDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secretDir, "api-key"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MULTIPILOT_API_KEY", "supersecret")
+	t.Setenv("MULTIPILOT_SECRETS", secretDir)
+	t.Setenv("MULTIPILOT_DOCS_URL", "https://docs.example.com/mcp")
+	env := []string{"KEY=${MULTIPILOT_API_KEY}", "API_KEY=file:" + filepath.Join(secretDir, "api-key"), "SECRET=file:${MULTIPILOT_SECRETS}/api-key"}
+	task := CopilotInput{
+		Env:              env,
+		LocalMcpServers:  map[string]copilot.MCPLocalServerConfig{"fs": {Env: map[string]string{"KEY": "${MULTIPILOT_API_KEY}"}}},
+		RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{"docs": {URL: "${MULTIPILOT_DOCS_URL}", Headers: map[string]string{"Authorization": "Bearer ${MULTIPILOT_API_KEY}"}}},
+	}
+	resolved, err := task.ResolveSecrets()
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if !slices.Equal(resolved.Env, []string{"KEY=supersecret", "API_KEY=s3cr3t", "SECRET=s3cr3t"}) || resolved.LocalMcpServers["fs"].Env["KEY"] != "supersecret" {
+		t.Fatalf("Expected the environment to be resolved, got %v and %v", resolved.Env, resolved.LocalMcpServers)
+	}
+	if resolved.RemoteMcpServers["docs"].URL != "https://docs.example.com/mcp" || resolved.RemoteMcpServers["docs"].Headers["Authorization"] != "Bearer supersecret" {
+		t.Fatalf("Expected the remote MCP server to be resolved, got %+v", resolved.RemoteMcpServers["docs"])
+	}
+	if env[0] != "KEY=${MULTIPILOT_API_KEY}" || task.LocalMcpServers["fs"].Env["KEY"] != "${MULTIPILOT_API_KEY}" {
+		t.Fatal("Expected the original task to be left untouched")
+	}
+
+	task = CopilotInput{
+		Env:              []string{"KEY=${MULTIPILOT_UNSET}"},
+		RemoteMcpServers: map[string]copilot.MCPRemoteServerConfig{"docs": {Headers: map[string]string{"Authorization": "${MULTIPILOT_TOKEN_UNSET}"}}},
+	}
+	expectedError := "unresolved environment variables: MULTIPILOT_UNSET (env[0]), MULTIPILOT_TOKEN_UNSET (remote_mcp_servers.docs.headers.Authorization)"
+	if _, err := task.ResolveSecrets(); err == nil || err.Error() != expectedError {
+		t.Fatalf("Expected error %q, got %v", expectedError, err)
+	}
+}
+
+func TestGetTokenReferences(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ghp_from_file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MULTIPILOT_TOKEN", "ghp_from_env")
+	testCases := []struct {
+		token         string
+		expected      string
+		expectedError string
+	}{
+		{token: "${MULTIPILOT_TOKEN}", expected: "ghp_from_env"},
+		{token: "${MULTIPILOT_UNSET:-ghp_default}", expected: "ghp_default"},
+		{token: "file:" + tokenFile, expected: "ghp_from_file"},
+		{token: "${MULTIPILOT_UNSET}", expectedError: "no value associated to environment variable MULTIPILOT_UNSET"},
+	}
+	for _, tc := range testCases {
+		token, err := CopilotInput{GitHubToken: tc.token}.GetToken()
+		if tc.expectedError != "" {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil || token != tc.expected {
+			t.Fatalf("Expected token %s, got %s (%v)", tc.expected, token, err)
+		}
+	}
+}
+
+func TestInterpolateSkipsPrompts(t *testing.T) {
+	tasks := CopilotTasks{
+		Tasks: []CopilotInput{
+			{
+				LogFile:      "rename.jsonl",
+				Cwd:          "/src",
+				Prompt:       "Rename ${FOO} to ${BAR} in the shell scripts",
+				SystemPrompt: "file: is a prefix used in our URLs",
+				Vars:         map[string]string{"example": "${HOME}"},
+			},
+			{
+				LogFile: "turns.jsonl",
+				Cwd:     "/src",
+				Prompts: []CopilotTurn{{Prompt: "file: is a prefix used in our URLs"}, {Prompt: "Replace $${FOO} with ${FOO:-foo}"}},
+			},
+		},
+	}
+	if err := tasks.Interpolate(t.TempDir()); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	task := tasks.Tasks[0]
+	if task.Prompt != "Rename ${FOO} to ${BAR} in the shell scripts" || task.SystemPrompt != "file: is a prefix used in our URLs" || task.Vars["example"] != "${HOME}" {
+		t.Fatalf("Expected the prompts and vars to be left untouched, got %+v", task)
+	}
+	turns := tasks.Tasks[1].Prompts
+	if turns[0].Prompt != "file: is a prefix used in our URLs" || turns[1].Prompt != "Replace $${FOO} with ${FOO:-foo}" {
+		t.Fatalf("Expected the turns to be left untouched, got %+v", turns)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
 	copilot "github.com/github/copilot-sdk/go"
@@ -12,25 +16,421 @@ import (
 
 const DefaultAiModel string = "gpt-4.1"
 const DefaultTimeout int64 = 120
+const DefaultHeartbeatTimeout int64 = 300
+const DefaultActivityTimeout int64 = 3600
+const DefaultMaxAttempts int32 = 10
+const DefaultInitialInterval int64 = 20
+const DefaultBackoffCoefficient float64 = 2.0
+const DefaultMaxInterval int64 = 100
+const MaxHookOutput int = 64 * 1024
+const DefaultMaxIterations int = 3
+const MaxVerifyFeedback int = 8 * 1024
+const RedactedToken string = "<redacted>"
+
+const IsolationWorktree string = "worktree"
+
+var modelSuffix = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+const DefaultBranch string = "multipilot/{{.WorkflowID}}"
+const DefaultCommitMessage string = "Apply multipilot task {{.Name}}"
+const GitCommitEvent string = "git.commit"
+const PreHookEvent string = "hook.pre_task"
+const PostHookEvent string = "hook.post_task"
+const VerifyEvent string = "verify.check"
+const AbortEvent string = "abort"
+
+const (
+	ConfigurationError  string = "ConfigurationError"
+	AuthenticationError string = "AuthenticationError"
+	InvalidModelError   string = "InvalidModelError"
+	ClientError         string = "ClientError"
+	GitError            string = "GitError"
+	SessionError        string = "SessionError"
+	HookError           string = "HookError"
+	VerificationError   string = "VerificationError"
+)
 
 type CopilotInput struct {
-	LogFile          string                                   `json:"log_file"`
-	Cwd              string                                   `json:"cwd"`
-	LogLevel         string                                   `json:"log_level"`
-	Env              []string                                 `json:"env"`
-	Prompt           string                                   `json:"prompt"`
-	GitHubToken      string                                   `json:"token"`
-	AiModel          string                                   `json:"ai_model"`
-	SystemPrompt     string                                   `json:"system_prompt"`
-	ExcludeTools     []string                                 `json:"exclude_tools"`
-	Skills           []string                                 `json:"skills"`
-	LocalMcpServers  map[string]copilot.MCPLocalServerConfig  `json:"local_mcp_servers"`
-	RemoteMcpServers map[string]copilot.MCPRemoteServerConfig `json:"remote_mcp_servers"`
-	Timeout          int64                                    `json:"timeout_sec"`
+	LogFile          string                                   `json:"log_file" yaml:"log_file" toml:"log_file"`
+	Cwd              string                                   `json:"cwd" yaml:"cwd" toml:"cwd"`
+	LogLevel         string                                   `json:"log_level" yaml:"log_level" toml:"log_level"`
+	Env              []string                                 `json:"env" yaml:"env" toml:"env"`
+	Prompt           string                                   `json:"prompt" yaml:"prompt" toml:"prompt"`
+	PromptFile       string                                   `json:"prompt_file" yaml:"prompt_file" toml:"prompt_file"`
+	GitHubToken      string                                   `json:"token" yaml:"token" toml:"token"`
+	AiModel          string                                   `json:"ai_model" yaml:"ai_model" toml:"ai_model"`
+	SystemPrompt     string                                   `json:"system_prompt" yaml:"system_prompt" toml:"system_prompt"`
+	SystemPromptFile string                                   `json:"system_prompt_file" yaml:"system_prompt_file" toml:"system_prompt_file"`
+	Vars             map[string]string                        `json:"vars" yaml:"vars" toml:"vars"`
+	ExcludeTools     []string                                 `json:"exclude_tools" yaml:"exclude_tools" toml:"exclude_tools"`
+	Skills           []string                                 `json:"skills" yaml:"skills" toml:"skills"`
+	LocalMcpServers  map[string]copilot.MCPLocalServerConfig  `json:"local_mcp_servers" yaml:"local_mcp_servers" toml:"local_mcp_servers"`
+	RemoteMcpServers map[string]copilot.MCPRemoteServerConfig `json:"remote_mcp_servers" yaml:"remote_mcp_servers" toml:"remote_mcp_servers"`
+	Timeout          int64                                    `json:"timeout_sec" yaml:"timeout_sec" toml:"timeout_sec"`
+	Prompts          []CopilotTurn                            `json:"prompts" yaml:"prompts" toml:"prompts"`
+	ID               string                                   `json:"id" yaml:"id" toml:"id"`
+	DependsOn        []string                                 `json:"depends_on" yaml:"depends_on" toml:"depends_on"`
+	FollowUpWindow   int64                                    `json:"follow_up_window_sec" yaml:"follow_up_window_sec" toml:"follow_up_window_sec"`
+	HeartbeatTimeout int64                                    `json:"heartbeat_timeout_sec" yaml:"heartbeat_timeout_sec" toml:"heartbeat_timeout_sec"`
+	ActivityTimeout  int64                                    `json:"activity_timeout_sec" yaml:"activity_timeout_sec" toml:"activity_timeout_sec"`
+	Retry            *RetryConfig                             `json:"retry" yaml:"retry" toml:"retry"`
+	Isolation        string                                   `json:"isolation" yaml:"isolation" toml:"isolation"`
+	Git              *GitConfig                               `json:"git" yaml:"git" toml:"git"`
+	PreHooks         []HookConfig                             `json:"pre_hooks" yaml:"pre_hooks" toml:"pre_hooks"`
+	PostHooks        []HookConfig                             `json:"post_hooks" yaml:"post_hooks" toml:"post_hooks"`
+	Verify           *VerifyConfig                            `json:"verify" yaml:"verify" toml:"verify"`
+	Targets          []string                                 `json:"targets" yaml:"targets" toml:"targets"`
+	AiModels         []string                                 `json:"ai_models" yaml:"ai_models" toml:"ai_models"`
+	Comparison       string                                   `json:"comparison,omitempty" yaml:"comparison,omitempty" toml:"comparison,omitempty"`
+	Extends          []string                                 `json:"extends,omitempty" yaml:"extends,omitempty" toml:"extends,omitempty"`
+	Override         []string                                 `json:"override,omitempty" yaml:"override,omitempty" toml:"override,omitempty"`
+}
+
+type VerifyConfig struct {
+	Command       string `json:"command" yaml:"command" toml:"command"`
+	MaxIterations *int   `json:"max_iterations" yaml:"max_iterations" toml:"max_iterations"`
+	Timeout       int64  `json:"timeout_sec" yaml:"timeout_sec" toml:"timeout_sec"`
+	FailOnError   bool   `json:"fail_on_error" yaml:"fail_on_error" toml:"fail_on_error"`
+}
+
+type HookConfig struct {
+	Command     string `json:"command" yaml:"command" toml:"command"`
+	FailOnError bool   `json:"fail_on_error" yaml:"fail_on_error" toml:"fail_on_error"`
+	Timeout     int64  `json:"timeout_sec" yaml:"timeout_sec" toml:"timeout_sec"`
+}
+
+type GitConfig struct {
+	Branch        string `json:"branch" yaml:"branch" toml:"branch"`
+	CommitMessage string `json:"commit_message" yaml:"commit_message" toml:"commit_message"`
+	Author        string `json:"author" yaml:"author" toml:"author"`
+	AllowDirty    bool   `json:"allow_dirty" yaml:"allow_dirty" toml:"allow_dirty"`
+}
+
+type GitTemplateData struct {
+	Name       string
+	WorkflowID string
+	Model      string
+}
+
+type PromptTemplateData struct {
+	Name   string
+	Cwd    string
+	Model  string
+	Repo   string
+	Branch string
+	Vars   map[string]string
+}
+
+type RetryConfig struct {
+	MaxAttempts            int32    `json:"max_attempts" yaml:"max_attempts" toml:"max_attempts"`
+	InitialInterval        int64    `json:"initial_interval_sec" yaml:"initial_interval_sec" toml:"initial_interval_sec"`
+	BackoffCoefficient     float64  `json:"backoff_coefficient" yaml:"backoff_coefficient" toml:"backoff_coefficient"`
+	MaxInterval            int64    `json:"max_interval_sec" yaml:"max_interval_sec" toml:"max_interval_sec"`
+	NonRetryableErrorTypes []string `json:"non_retryable_error_types" yaml:"non_retryable_error_types" toml:"non_retryable_error_types"`
+}
+
+type CopilotTurn struct {
+	Prompt  string `json:"prompt" yaml:"prompt" toml:"prompt"`
+	Timeout int64  `json:"timeout_sec" yaml:"timeout_sec" toml:"timeout_sec"`
 }
 
 type CopilotTasks struct {
-	Tasks []CopilotInput `json:"tasks"`
+	Tasks            []CopilotInput          `json:"tasks" yaml:"tasks" toml:"tasks"`
+	MaxParallel      int                     `json:"max_parallel" yaml:"max_parallel" toml:"max_parallel"`
+	SearchAttributes bool                    `json:"search_attributes" yaml:"search_attributes" toml:"search_attributes"`
+	Defaults         *CopilotInput           `json:"defaults,omitempty" yaml:"defaults,omitempty" toml:"defaults,omitempty"`
+	Profiles         map[string]CopilotInput `json:"profiles,omitempty" yaml:"profiles,omitempty" toml:"profiles,omitempty"`
+}
+
+const (
+	TaskSucceeded string = "succeeded"
+	TaskFailed    string = "failed"
+	TaskSkipped   string = "skipped"
+	TaskPending   string = "pending"
+	TaskRunning   string = "running"
+)
+
+type TaskOutcome struct {
+	TaskID     string         `json:"task_id"`
+	WorkflowID string         `json:"workflow_id"`
+	LogFile    string         `json:"log_file"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	ErrorType  string         `json:"error_type,omitempty"`
+	Result     *CopilotResult `json:"result,omitempty"`
+}
+
+type CopilotResult struct {
+	FinalMessage  string        `json:"final_message"`
+	Turns         int           `json:"turns"`
+	ToolCalls     int           `json:"tool_calls"`
+	InputTokens   int64         `json:"input_tokens"`
+	OutputTokens  int64         `json:"output_tokens"`
+	Duration      time.Duration `json:"duration"`
+	FilesChanged  []string      `json:"files_changed"`
+	LogFile       string        `json:"log_file"`
+	Branch        string        `json:"branch,omitempty"`
+	Worktree      string        `json:"worktree,omitempty"`
+	Diff          *CopilotDiff  `json:"diff,omitempty"`
+	Commit        string        `json:"commit,omitempty"`
+	Verification  *Verification `json:"verification,omitempty"`
+	HostTaskQueue string        `json:"host_task_queue,omitempty"`
+}
+
+type Verification struct {
+	Passed     bool `json:"passed"`
+	Iterations int  `json:"iterations"`
+}
+
+type RepoSnapshot struct {
+	Commit     string   `json:"commit"`
+	DirtyFiles []string `json:"dirty_files"`
+}
+
+type FileDiff struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type CopilotDiff struct {
+	Base      RepoSnapshot `json:"base"`
+	Files     []FileDiff   `json:"files"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+	PatchFile string       `json:"patch_file"`
+}
+
+func (r *CopilotResult) Merge(other CopilotResult) {
+	if other.FinalMessage != "" {
+		r.FinalMessage = other.FinalMessage
+	}
+	r.Turns += other.Turns
+	r.ToolCalls += other.ToolCalls
+	r.InputTokens += other.InputTokens
+	r.OutputTokens += other.OutputTokens
+	r.Duration += other.Duration
+	if other.FilesChanged != nil {
+		r.FilesChanged = other.FilesChanged
+	}
+	if other.LogFile != "" {
+		r.LogFile = other.LogFile
+	}
+	if other.Branch != "" {
+		r.Branch = other.Branch
+	}
+	if other.Worktree != "" {
+		r.Worktree = other.Worktree
+	}
+	if other.Diff != nil {
+		r.Diff = other.Diff
+	}
+	if other.Commit != "" {
+		r.Commit = other.Commit
+	}
+	if other.HostTaskQueue != "" {
+		r.HostTaskQueue = other.HostTaskQueue
+	}
+	if other.Verification != nil {
+		iterations := other.Verification.Iterations
+		if r.Verification != nil {
+			iterations += r.Verification.Iterations
+		}
+		r.Verification = &Verification{Passed: other.Verification.Passed, Iterations: iterations}
+	}
+}
+
+func DiffFile(logFile string) string {
+	return strings.TrimSuffix(logFile, filepath.Ext(logFile)) + ".diff"
+}
+
+func ComparisonFile(logFile string) string {
+	if logFile == "" {
+		return "comparison.json"
+	}
+	return strings.TrimSuffix(logFile, filepath.Ext(logFile)) + "-comparison.json"
+}
+
+type BatchResult struct {
+	BatchID     string            `json:"batch_id"`
+	Tasks       []TaskOutcome     `json:"tasks"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Skipped     int               `json:"skipped"`
+	Comparisons []ModelComparison `json:"comparisons,omitempty"`
+}
+
+type BatchManifest struct {
+	BatchID string         `json:"batch_id"`
+	RunID   string         `json:"run_id"`
+	Tasks   []ManifestTask `json:"tasks"`
+}
+
+type ManifestTask struct {
+	TaskID     string `json:"task_id"`
+	WorkflowID string `json:"workflow_id"`
+	LogFile    string `json:"log_file"`
+}
+
+type BatchStatus struct {
+	BatchID     string        `json:"batch_id"`
+	MaxParallel int           `json:"max_parallel"`
+	Tasks       []TaskOutcome `json:"tasks"`
+}
+
+func (b BatchStatus) Count(status string) int {
+	count := 0
+	for _, task := range b.Tasks {
+		if task.Status == status {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Memo keys attached to the workflow of each task, shown by `multipilot list`
+const (
+	MemoTaskName = "task_name"
+	MemoCwd      = "cwd"
+	MemoModel    = "model"
+	MemoLogFile  = "log_file"
+)
+
+type WorkflowFilter struct {
+	Status           string
+	Since            time.Time
+	Until            time.Time
+	Cwd              string
+	Model            string
+	Batches          bool
+	SearchAttributes bool
+}
+
+type WorkflowSummary struct {
+	WorkflowID string    `json:"workflow_id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	TaskName   string    `json:"task_name,omitempty"`
+	Cwd        string    `json:"cwd,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	LogFile    string    `json:"log_file,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	CloseTime  time.Time `json:"close_time"`
+}
+
+type ActivityAttempts struct {
+	ActivityID string        `json:"activity_id"`
+	Activity   string        `json:"activity"`
+	Status     string        `json:"status"`
+	Attempts   int32         `json:"attempts"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type WorkflowDescription struct {
+	WorkflowSummary
+	Activities []ActivityAttempts `json:"activities"`
+	Input      any                `json:"input,omitempty"`
+	Result     any                `json:"result,omitempty"`
+	Failure    string             `json:"failure,omitempty"`
+}
+
+type ModelComparison struct {
+	Report string     `json:"report"`
+	Runs   []ModelRun `json:"runs"`
+}
+
+type ModelRun struct {
+	Model        string        `json:"model"`
+	TaskID       string        `json:"task_id"`
+	WorkflowID   string        `json:"workflow_id"`
+	Status       string        `json:"status"`
+	Error        string        `json:"error,omitempty"`
+	LogFile      string        `json:"log_file"`
+	Duration     time.Duration `json:"duration"`
+	InputTokens  int64         `json:"input_tokens"`
+	OutputTokens int64         `json:"output_tokens"`
+	ToolCalls    int           `json:"tool_calls"`
+	FilesChanged int           `json:"files_changed"`
+	Additions    int           `json:"additions"`
+	Deletions    int           `json:"deletions"`
+}
+
+// CompareModels groups the outcomes of the tasks expanded from ai_models by
+// comparison report, in the order of the tasks.
+func CompareModels(tasks []CopilotInput, outcomes []TaskOutcome) []ModelComparison {
+	var comparisons []ModelComparison
+	reports := make(map[string]int)
+	for i, task := range tasks {
+		if task.Comparison == "" {
+			continue
+		}
+		j, ok := reports[task.Comparison]
+		if !ok {
+			j = len(comparisons)
+			reports[task.Comparison] = j
+			comparisons = append(comparisons, ModelComparison{Report: task.Comparison})
+		}
+		outcome := outcomes[i]
+		run := ModelRun{Model: task.AiModel, TaskID: outcome.TaskID, WorkflowID: outcome.WorkflowID, Status: outcome.Status, Error: outcome.Error, LogFile: task.LogFile}
+		if result := outcome.Result; result != nil {
+			run.Duration = result.Duration
+			run.InputTokens = result.InputTokens
+			run.OutputTokens = result.OutputTokens
+			run.ToolCalls = result.ToolCalls
+			run.FilesChanged = len(result.FilesChanged)
+			if result.Diff != nil {
+				run.FilesChanged = len(result.Diff.Files)
+				run.Additions = result.Diff.Additions
+				run.Deletions = result.Diff.Deletions
+			}
+		}
+		comparisons[j].Runs = append(comparisons[j].Runs, run)
+	}
+	return comparisons
+}
+
+const (
+	PhaseRunning             string = "running"
+	PhaseStartingClient      string = "starting client"
+	PhaseSessionCreated      string = "session created"
+	PhaseWaitingOnModel      string = "waiting on model"
+	PhaseToolRunning         string = "tool running"
+	PhaseRunningHooks        string = "running hooks"
+	PhaseVerifying           string = "verifying"
+	PhaseWaitingForFollowUps string = "waiting for follow-ups"
+	PhaseRunningFollowUp     string = "running follow-up"
+	PhaseCompleted           string = "completed"
+	PhaseFailed              string = "failed"
+	PhaseCanceled            string = "canceled"
+)
+
+type CopilotProgress struct {
+	Phase         string `json:"phase"`
+	Turn          int    `json:"turn"`
+	LastEventType string `json:"last_event_type"`
+	EventCount    int    `json:"event_count"`
+}
+
+type CopilotStatus struct {
+	Phase              string        `json:"phase"`
+	Turn               int           `json:"turn"`
+	LastEventType      string        `json:"last_event_type"`
+	EventCount         int           `json:"event_count"`
+	StartedAt          time.Time     `json:"started_at"`
+	Elapsed            time.Duration `json:"elapsed"`
+	Attempt            int32         `json:"attempt"`
+	FollowUpsDelivered int           `json:"follow_ups_delivered"`
+}
+
+func (s *CopilotStatus) ApplyProgress(progress CopilotProgress, attempt int32) {
+	if progress.Phase != "" {
+		s.Phase = progress.Phase
+	}
+	s.Turn = progress.Turn
+	s.LastEventType = progress.LastEventType
+	s.EventCount = progress.EventCount
+	s.Attempt = attempt
 }
 
 type CopilotEvent struct {
@@ -65,33 +465,473 @@ func (c CopilotInput) GetLogFile() (string, error) {
 	return c.LogFile, nil
 }
 
+// GetToken resolves the token on the worker: besides literal tokens, it accepts
+// references to environment variables, such as $GITHUB_TOKEN or ${MY_TOKEN},
+// and to files, such as file:/run/secrets/token.
 func (c CopilotInput) GetToken() (string, error) {
-	if c.GitHubToken != "" {
-		if c.GitHubToken == "$GH_TOKEN" || c.GitHubToken == "$GITHUB_TOKEN" {
-			envVar := strings.TrimPrefix(c.GitHubToken, "$")
-			val, ok := os.LookupEnv(envVar)
-			if !ok {
-				return "", fmt.Errorf("no value associated to environment variable %s", envVar)
+	if c.GitHubToken == "" {
+		return "", nil
+	}
+	token := c.GitHubToken
+	if token == "$GH_TOKEN" || token == "$GITHUB_TOKEN" {
+		token = "${" + strings.TrimPrefix(token, "$") + "}"
+	}
+	val, missing, err := expandValue(token, "")
+	if err != nil {
+		return "", err
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value associated to environment variable %s", strings.Join(missing, ", "))
+	}
+	return val, nil
+}
+
+// Redacted returns a copy of the task that can be shown to users: a literal
+// token is replaced, while a reference to an environment variable or to a file
+// is kept.
+func (c CopilotInput) Redacted() CopilotInput {
+	if c.GitHubToken != "" && !isTokenReference(c.GitHubToken) {
+		c.GitHubToken = RedactedToken
+	}
+	return c
+}
+
+func isTokenReference(token string) bool {
+	if token == "$GH_TOKEN" || token == "$GITHUB_TOKEN" || strings.HasPrefix(token, "file:") {
+		return true
+	}
+	// a default value could be a literal token
+	match := variablePattern.FindStringSubmatch(token)
+	return match != nil && match[0] == token && match[2] == "" && !strings.HasPrefix(token, "$$")
+}
+
+func (c CopilotInput) GetTimeout() int64 {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c CopilotInput) GetHeartbeatTimeout() int64 {
+	if c.HeartbeatTimeout <= 0 {
+		return DefaultHeartbeatTimeout
+	}
+	return c.HeartbeatTimeout
+}
+
+func (c CopilotInput) GetActivityTimeout() int64 {
+	if c.ActivityTimeout <= 0 {
+		return DefaultActivityTimeout
+	}
+	return c.ActivityTimeout
+}
+
+func (c CopilotInput) GetRetry() RetryConfig {
+	retry := RetryConfig{
+		MaxAttempts:        DefaultMaxAttempts,
+		InitialInterval:    DefaultInitialInterval,
+		BackoffCoefficient: DefaultBackoffCoefficient,
+		MaxInterval:        DefaultMaxInterval,
+	}
+	if c.Retry == nil {
+		return retry
+	}
+	if c.Retry.MaxAttempts > 0 {
+		retry.MaxAttempts = c.Retry.MaxAttempts
+	}
+	if c.Retry.InitialInterval > 0 {
+		retry.InitialInterval = c.Retry.InitialInterval
+	}
+	if c.Retry.BackoffCoefficient > 0 {
+		retry.BackoffCoefficient = c.Retry.BackoffCoefficient
+	}
+	if c.Retry.MaxInterval > 0 {
+		retry.MaxInterval = c.Retry.MaxInterval
+	}
+	retry.NonRetryableErrorTypes = c.Retry.NonRetryableErrorTypes
+	return retry
+}
+
+func (c CopilotInput) GetTurns() []CopilotTurn {
+	timeout := c.GetTimeout()
+	if len(c.Prompts) == 0 {
+		return []CopilotTurn{{Prompt: c.Prompt, Timeout: timeout}}
+	}
+	turns := make([]CopilotTurn, 0, len(c.Prompts))
+	for _, turn := range c.Prompts {
+		if turn.Timeout <= 0 {
+			turn.Timeout = timeout
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+func (c CopilotInput) GetHookTimeout(hook HookConfig) int64 {
+	if hook.Timeout <= 0 {
+		return c.GetTimeout()
+	}
+	return hook.Timeout
+}
+
+func (c CopilotInput) GetVerify() *VerifyConfig {
+	if c.Verify == nil {
+		return nil
+	}
+	verify := *c.Verify
+	// 0 runs the check once without sending its output back, so only a missing
+	// value gets the default
+	if verify.MaxIterations == nil {
+		maxIterations := DefaultMaxIterations
+		verify.MaxIterations = &maxIterations
+	}
+	if verify.Timeout <= 0 {
+		verify.Timeout = c.GetTimeout()
+	}
+	return &verify
+}
+
+func (c CopilotInput) GetName() string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return c.LogFile
+}
+
+func (g GitConfig) GetBranch(data GitTemplateData) (string, error) {
+	if g.Branch == "" {
+		return renderTemplate("branch", DefaultBranch, data)
+	}
+	return renderTemplate("branch", g.Branch, data)
+}
+
+func (g GitConfig) GetCommitMessage(data GitTemplateData) (string, error) {
+	if g.CommitMessage == "" {
+		return renderTemplate("commit_message", DefaultCommitMessage, data)
+	}
+	return renderTemplate("commit_message", g.CommitMessage, data)
+}
+
+func renderTemplate(name, text string, data GitTemplateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err.Error())
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("invalid %s template: %s", name, err.Error())
+	}
+	if strings.TrimSpace(rendered.String()) == "" {
+		return "", fmt.Errorf("%s cannot be empty", name)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// LoadPrompts replaces the prompt and the system prompt of the task with the
+// content of prompt_file and system_prompt_file, rendered as templates. Relative
+// paths are resolved from baseDir, the directory of the config file.
+func (c *CopilotInput) LoadPrompts(baseDir, repo, branch string) error {
+	if c.PromptFile != "" && (c.Prompt != "" || len(c.Prompts) > 0) {
+		return errors.New("cannot use prompt_file along with prompt or prompts within the same task")
+	}
+	if c.SystemPromptFile != "" && c.SystemPrompt != "" {
+		return errors.New("cannot use both system_prompt and system_prompt_file within the same task")
+	}
+	model := c.AiModel
+	if model == "" {
+		model = DefaultAiModel
+	}
+	data := PromptTemplateData{Name: c.GetName(), Cwd: c.Cwd, Model: model, Repo: repo, Branch: branch, Vars: c.Vars}
+	var err error
+	if c.PromptFile != "" {
+		if c.Prompt, err = renderPromptFile(baseDir, c.PromptFile, data); err != nil {
+			return err
+		}
+	}
+	if c.SystemPromptFile != "" {
+		if c.SystemPrompt, err = renderPromptFile(baseDir, c.SystemPromptFile, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderPromptFile(baseDir, path string, data PromptTemplateData) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template %s: %s", path, err.Error())
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("invalid prompt template %s: %s", path, err.Error())
+	}
+	if strings.TrimSpace(rendered.String()) == "" {
+		return "", fmt.Errorf("prompt template %s cannot render to an empty prompt", path)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// Expand replaces each task with targets by one task per target directory, and
+// each task with ai_models by one task per model. Every copy gets its own log
+// file and id, and dependencies on an expanded task become dependencies on all
+// of its copies.
+func (t *CopilotTasks) Expand() error {
+	ids := make(map[string][]string)
+	tasks, err := expandTasks(t.Tasks, ids, expandTargets)
+	if err != nil {
+		return err
+	}
+	tasks, err = expandTasks(tasks, ids, expandModels)
+	if err != nil {
+		return err
+	}
+	var resolve func(id string) []string
+	resolve = func(id string) []string {
+		copies, ok := ids[id]
+		if !ok {
+			return []string{id}
+		}
+		resolved := []string{}
+		for _, c := range copies {
+			resolved = append(resolved, resolve(c)...)
+		}
+		return resolved
+	}
+	for i, task := range tasks {
+		if len(task.DependsOn) == 0 {
+			continue
+		}
+		deps := make([]string, 0, len(task.DependsOn))
+		for _, dep := range task.DependsOn {
+			deps = append(deps, resolve(dep)...)
+		}
+		tasks[i].DependsOn = deps
+	}
+	t.Tasks = tasks
+	return nil
+}
+
+// expandTasks replaces the tasks for which expand returns copies, suffixing the
+// log file and id of each copy.
+func expandTasks(tasks []CopilotInput, ids map[string][]string, expand func(CopilotInput) ([]CopilotInput, []string, error)) ([]CopilotInput, error) {
+	expanded := make([]CopilotInput, 0, len(tasks))
+	for _, task := range tasks {
+		copies, suffixes, err := expand(task)
+		if err != nil {
+			return nil, err
+		}
+		if copies == nil {
+			expanded = append(expanded, task)
+			continue
+		}
+		for i, c := range copies {
+			c.LogFile = suffixLogFile(task.LogFile, suffixes[i])
+			if task.ID != "" {
+				c.ID = task.ID + "-" + suffixes[i]
+				ids[task.ID] = append(ids[task.ID], c.ID)
 			}
-			return val, nil
+			expanded = append(expanded, c)
 		}
-		return c.GitHubToken, nil
 	}
-	return c.GitHubToken, nil
+	return expanded, nil
+}
+
+func expandTargets(task CopilotInput) ([]CopilotInput, []string, error) {
+	if len(task.Targets) == 0 {
+		return nil, nil, nil
+	}
+	dirs, err := task.resolveTargets()
+	if err != nil {
+		return nil, nil, err
+	}
+	copies := make([]CopilotInput, 0, len(dirs))
+	suffixes := make([]string, 0, len(dirs))
+	names := make(map[string]int)
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		names[name] += 1
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, names[name])
+		}
+		c := task
+		c.Targets = nil
+		c.Cwd = dir
+		copies = append(copies, c)
+		suffixes = append(suffixes, name)
+	}
+	return copies, suffixes, nil
+}
+
+func expandModels(task CopilotInput) ([]CopilotInput, []string, error) {
+	if len(task.AiModels) == 0 {
+		return nil, nil, nil
+	}
+	if task.AiModel != "" {
+		return nil, nil, errors.New("cannot use both ai_model and ai_models within the same task")
+	}
+	if task.Isolation != "" && task.Isolation != IsolationWorktree {
+		return nil, nil, fmt.Errorf("ai_models requires worktree isolation, got %s", task.Isolation)
+	}
+	copies := make([]CopilotInput, 0, len(task.AiModels))
+	suffixes := make([]string, 0, len(task.AiModels))
+	for _, model := range task.AiModels {
+		c := task
+		c.AiModels = nil
+		c.AiModel = model
+		// the models work on the same cwd, each in its own worktree
+		c.Isolation = IsolationWorktree
+		c.Comparison = ComparisonFile(task.LogFile)
+		copies = append(copies, c)
+		suffixes = append(suffixes, modelSuffix.ReplaceAllString(model, "-"))
+	}
+	return copies, suffixes, nil
+}
+
+func (c CopilotInput) resolveTargets() ([]string, error) {
+	dirs := []string{}
+	seen := make(map[string]bool)
+	for _, target := range c.Targets {
+		// relative targets are resolved against the cwd of the task, if any
+		if !filepath.IsAbs(target) && c.Cwd != "" {
+			target = filepath.Join(c.Cwd, target)
+		}
+		matches, err := filepath.Glob(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %s: %s", target, err.Error())
+		}
+		found := false
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+			found = true
+			if !seen[match] {
+				seen[match] = true
+				dirs = append(dirs, match)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("target %s does not match any directory", target)
+		}
+	}
+	return dirs, nil
+}
+
+func suffixLogFile(logFile, name string) string {
+	if logFile == "" {
+		return name + ".jsonl"
+	}
+	ext := filepath.Ext(logFile)
+	return strings.TrimSuffix(logFile, ext) + "-" + name + ext
 }
 
 func (t *CopilotTasks) Validate() error {
+	if t.MaxParallel < 0 {
+		return errors.New("max_parallel cannot be negative")
+	}
 	logFiles := make(map[string]int)
 	cwds := make(map[string]int)
 	for i, task := range t.Tasks {
-		if _, ok := cwds[task.Cwd]; ok {
-			return errors.New("cannot use the same working directory for mulitple tasks because of potential race conditions")
+		if task.Prompt != "" && len(task.Prompts) > 0 {
+			return errors.New("cannot use both prompt and prompts within the same task")
+		}
+		if task.Retry != nil && task.Retry.BackoffCoefficient > 0 && task.Retry.BackoffCoefficient < 1 {
+			return errors.New("backoff_coefficient cannot be lower than 1")
+		}
+		switch task.Isolation {
+		case "":
+			if _, ok := cwds[task.Cwd]; ok {
+				return errors.New("cannot use the same working directory for mulitple tasks because of potential race conditions")
+			}
+			cwds[task.Cwd] = i
+		case IsolationWorktree:
+			// each task works within its own git worktree
+		default:
+			return fmt.Errorf("unsupported isolation mode: %s", task.Isolation)
+		}
+		for _, hook := range slices.Concat(task.PreHooks, task.PostHooks) {
+			if strings.TrimSpace(hook.Command) == "" {
+				return errors.New("hook command cannot be empty")
+			}
+		}
+		if task.Verify != nil {
+			if strings.TrimSpace(task.Verify.Command) == "" {
+				return errors.New("verify command cannot be empty")
+			}
+			if task.Verify.MaxIterations != nil && *task.Verify.MaxIterations < 0 {
+				return errors.New("max_iterations cannot be negative")
+			}
+		}
+		if task.Git != nil {
+			// render the templates with placeholder values to catch errors before starting the batch
+			data := GitTemplateData{Name: task.GetName(), WorkflowID: "workflow", Model: task.AiModel}
+			if _, err := task.Git.GetBranch(data); err != nil {
+				return err
+			}
+			if _, err := task.Git.GetCommitMessage(data); err != nil {
+				return err
+			}
 		}
 		if _, ok := logFiles[task.LogFile]; ok {
 			return errors.New("cannot use the same log file for two or more tasks because of potential race conditions")
 		}
 		logFiles[task.LogFile] = i
-		cwds[task.Cwd] = i
+	}
+	return t.validateDependencies()
+}
+
+func (t *CopilotTasks) validateDependencies() error {
+	ids := make(map[string]int)
+	for i, task := range t.Tasks {
+		if task.ID == "" {
+			continue
+		}
+		if _, ok := ids[task.ID]; ok {
+			return fmt.Errorf("cannot use the same id (%s) for two or more tasks", task.ID)
+		}
+		ids[task.ID] = i
+	}
+	for _, task := range t.Tasks {
+		for _, dep := range task.DependsOn {
+			if _, ok := ids[dep]; !ok {
+				return fmt.Errorf("task %s depends on unknown task %s", task.GetName(), dep)
+			}
+		}
+	}
+	// 0: not visited, 1: visiting, 2: visited
+	state := make([]int8, len(t.Tasks))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			cycle := path[slices.Index(path, t.Tasks[i].ID):]
+			return fmt.Errorf("dependency cycle detected: %s -> %s", strings.Join(cycle, " -> "), t.Tasks[i].ID)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		path = append(path, t.Tasks[i].ID)
+		for _, dep := range t.Tasks[i].DependsOn {
+			if err := visit(ids[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = 2
+		return nil
+	}
+	for i := range t.Tasks {
+		if err := visit(i); err != nil {
+			return err
+		}
 	}
 	return nil
 }
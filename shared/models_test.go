@@ -1,7 +1,13 @@
 package shared
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	copilot "github.com/github/copilot-sdk/go"
 )
@@ -241,6 +247,207 @@ func TestCopilotTasks(t *testing.T) {
 			expectedError: true,
 			errorMessage:  "cannot use the same working directory for mulitple tasks because of potential race conditions",
 		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+						Prompt:  "Say hello",
+						Prompts: []CopilotTurn{{Prompt: "Say hello again"}},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "cannot use both prompt and prompts within the same task",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						ID:      "backend",
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+					},
+					{
+						ID:        "frontend",
+						LogFile:   "hello1.jsonl",
+						Cwd:       "/test/dir1",
+						DependsOn: []string{"backend"},
+					},
+				},
+			},
+			expectedError: false,
+			errorMessage:  "",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						ID:      "backend",
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+					},
+					{
+						ID:      "backend",
+						LogFile: "hello1.jsonl",
+						Cwd:     "/test/dir1",
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "cannot use the same id (backend) for two or more tasks",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						ID:        "frontend",
+						LogFile:   "hello.jsonl",
+						Cwd:       "/test/dir",
+						DependsOn: []string{"backend"},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "task frontend depends on unknown task backend",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						ID:        "a",
+						LogFile:   "hello.jsonl",
+						Cwd:       "/test/dir",
+						DependsOn: []string{"c"},
+					},
+					{
+						ID:        "b",
+						LogFile:   "hello1.jsonl",
+						Cwd:       "/test/dir1",
+						DependsOn: []string{"a"},
+					},
+					{
+						ID:        "c",
+						LogFile:   "hello2.jsonl",
+						Cwd:       "/test/dir2",
+						DependsOn: []string{"b"},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "dependency cycle detected: a -> c -> b -> a",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+						Retry:   &RetryConfig{BackoffCoefficient: 0.5},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "backoff_coefficient cannot be lower than 1",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile:   "hello.jsonl",
+						Cwd:       "/test/dir",
+						Isolation: IsolationWorktree,
+					},
+					{
+						LogFile:   "hello1.jsonl",
+						Cwd:       "/test/dir",
+						Isolation: IsolationWorktree,
+					},
+				},
+			},
+			expectedError: false,
+			errorMessage:  "",
+		},
+		{
+			tasks: CopilotTasks{
+				MaxParallel: -1,
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "max_parallel cannot be negative",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile:   "hello.jsonl",
+						Cwd:       "/test/dir",
+						Isolation: "container",
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "unsupported isolation mode: container",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+						Git:     &GitConfig{Branch: "multipilot/{{.Branch}}"},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "invalid branch template: template: branch:1:13: executing \"branch\" at <.Branch>: can't evaluate field Branch in type shared.GitTemplateData",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+						Git:     &GitConfig{CommitMessage: "{{if .Model}}{{end}}"},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "commit_message cannot be empty",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile:   "hello.jsonl",
+						Cwd:       "/test/dir",
+						PreHooks:  []HookConfig{{Command: "go mod download"}},
+						PostHooks: []HookConfig{{Command: " "}},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "hook command cannot be empty",
+		},
+		{
+			tasks: CopilotTasks{
+				Tasks: []CopilotInput{
+					{
+						LogFile: "hello.jsonl",
+						Cwd:     "/test/dir",
+						Verify:  &VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(-1)},
+					},
+				},
+			},
+			expectedError: true,
+			errorMessage:  "max_iterations cannot be negative",
+		},
 	}
 	for _, tc := range testCases {
 		err := tc.tasks.Validate()
@@ -255,3 +462,384 @@ func TestCopilotTasks(t *testing.T) {
 		}
 	}
 }
+
+func TestGetTurns(t *testing.T) {
+	testCases := []struct {
+		task          CopilotInput
+		expectedTurns []CopilotTurn
+	}{
+		{
+			task:          CopilotInput{Prompt: "Say hello"},
+			expectedTurns: []CopilotTurn{{Prompt: "Say hello", Timeout: DefaultTimeout}},
+		},
+		{
+			task:          CopilotInput{Prompt: "Say hello", Timeout: 300},
+			expectedTurns: []CopilotTurn{{Prompt: "Say hello", Timeout: 300}},
+		},
+		{
+			task: CopilotInput{
+				Timeout: 300,
+				Prompts: []CopilotTurn{
+					{Prompt: "Analyze"},
+					{Prompt: "Implement", Timeout: 600},
+					{Prompt: "Write tests"},
+				},
+			},
+			expectedTurns: []CopilotTurn{
+				{Prompt: "Analyze", Timeout: 300},
+				{Prompt: "Implement", Timeout: 600},
+				{Prompt: "Write tests", Timeout: 300},
+			},
+		},
+		{
+			task: CopilotInput{
+				Prompts: []CopilotTurn{{Prompt: "Analyze"}},
+			},
+			expectedTurns: []CopilotTurn{{Prompt: "Analyze", Timeout: DefaultTimeout}},
+		},
+	}
+	for _, tc := range testCases {
+		turns := tc.task.GetTurns()
+		if !slices.Equal(turns, tc.expectedTurns) {
+			t.Fatalf("Expected turns to be %v, got %v", tc.expectedTurns, turns)
+		}
+	}
+}
+
+func TestApplyProgress(t *testing.T) {
+	status := CopilotStatus{Phase: PhaseRunning, FollowUpsDelivered: 1}
+	status.ApplyProgress(CopilotProgress{Phase: PhaseToolRunning, Turn: 2, LastEventType: "tool.execution_start", EventCount: 12}, 3)
+	expected := CopilotStatus{Phase: PhaseToolRunning, Turn: 2, LastEventType: "tool.execution_start", EventCount: 12, Attempt: 3, FollowUpsDelivered: 1}
+	if status != expected {
+		t.Fatalf("Expected status to be %v, got %v", expected, status)
+	}
+	// activities that did not heartbeat yet do not override the phase known by the workflow
+	status = CopilotStatus{Phase: PhaseRunningFollowUp}
+	status.ApplyProgress(CopilotProgress{}, 1)
+	if status.Phase != PhaseRunningFollowUp || status.Attempt != 1 {
+		t.Fatalf("Expected phase %s and attempt 1, got %s and %d", PhaseRunningFollowUp, status.Phase, status.Attempt)
+	}
+}
+
+func TestGetRetry(t *testing.T) {
+	testCases := []struct {
+		task          CopilotInput
+		expectedRetry RetryConfig
+	}{
+		{
+			task:          CopilotInput{},
+			expectedRetry: RetryConfig{MaxAttempts: DefaultMaxAttempts, InitialInterval: DefaultInitialInterval, BackoffCoefficient: DefaultBackoffCoefficient, MaxInterval: DefaultMaxInterval},
+		},
+		{
+			task:          CopilotInput{Retry: &RetryConfig{MaxAttempts: 1}},
+			expectedRetry: RetryConfig{MaxAttempts: 1, InitialInterval: DefaultInitialInterval, BackoffCoefficient: DefaultBackoffCoefficient, MaxInterval: DefaultMaxInterval},
+		},
+		{
+			task:          CopilotInput{Retry: &RetryConfig{InitialInterval: 5, BackoffCoefficient: 1.5, MaxInterval: 60, NonRetryableErrorTypes: []string{"SessionError"}}},
+			expectedRetry: RetryConfig{MaxAttempts: DefaultMaxAttempts, InitialInterval: 5, BackoffCoefficient: 1.5, MaxInterval: 60, NonRetryableErrorTypes: []string{"SessionError"}},
+		},
+	}
+	for _, tc := range testCases {
+		retry := tc.task.GetRetry()
+		if retry.MaxAttempts != tc.expectedRetry.MaxAttempts || retry.InitialInterval != tc.expectedRetry.InitialInterval || retry.BackoffCoefficient != tc.expectedRetry.BackoffCoefficient || retry.MaxInterval != tc.expectedRetry.MaxInterval || !slices.Equal(retry.NonRetryableErrorTypes, tc.expectedRetry.NonRetryableErrorTypes) {
+			t.Fatalf("Expected retry config to be %v, got %v", tc.expectedRetry, retry)
+		}
+	}
+}
+
+func TestGitConfig(t *testing.T) {
+	data := GitTemplateData{Name: "logging", WorkflowID: "multipilot-123-task-0", Model: "gpt-5"}
+	testCases := []struct {
+		config          GitConfig
+		expectedBranch  string
+		expectedMessage string
+	}{
+		{
+			config:          GitConfig{},
+			expectedBranch:  "multipilot/multipilot-123-task-0",
+			expectedMessage: "Apply multipilot task logging",
+		},
+		{
+			config:          GitConfig{Branch: "chore/{{.Name}}", CommitMessage: "chore: {{.Name}} ({{.Model}})"},
+			expectedBranch:  "chore/logging",
+			expectedMessage: "chore: logging (gpt-5)",
+		},
+	}
+	for _, tc := range testCases {
+		branch, err := tc.config.GetBranch(data)
+		if err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		message, err := tc.config.GetCommitMessage(data)
+		if err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		if branch != tc.expectedBranch || message != tc.expectedMessage {
+			t.Fatalf("Expected branch %s and message %s, got %s and %s", tc.expectedBranch, tc.expectedMessage, branch, message)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestGetVerify(t *testing.T) {
+	if verify := (CopilotInput{}).GetVerify(); verify != nil {
+		t.Fatalf("Expected no verify configuration, got %v", verify)
+	}
+	testCases := []struct {
+		input    CopilotInput
+		expected VerifyConfig
+	}{
+		{
+			input:    CopilotInput{Verify: &VerifyConfig{Command: "go test ./..."}},
+			expected: VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(DefaultMaxIterations), Timeout: DefaultTimeout},
+		},
+		{
+			input:    CopilotInput{Timeout: 300, Verify: &VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(5), FailOnError: true}},
+			expected: VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(5), Timeout: 300, FailOnError: true},
+		},
+		{
+			input:    CopilotInput{Verify: &VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(0)}},
+			expected: VerifyConfig{Command: "go test ./...", MaxIterations: intPtr(0), Timeout: DefaultTimeout},
+		},
+	}
+	for _, tc := range testCases {
+		verify := tc.input.GetVerify()
+		if verify == nil || !reflect.DeepEqual(*verify, tc.expected) {
+			t.Fatalf("Expected %v, got %v", tc.expected, verify)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"services/auth", "services/billing", "libs/auth"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "services", "README.md"), []byte("# services\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := CopilotTasks{
+		Tasks: []CopilotInput{
+			{ID: "migrate", LogFile: "logs/migrate.jsonl", Cwd: root, Targets: []string{"services/*", filepath.Join(root, "libs", "auth")}, Prompt: "Migrate to the new logger"},
+			{ID: "changelog", LogFile: "changelog.jsonl", Cwd: root, DependsOn: []string{"migrate"}, Prompt: "Update the changelog"},
+		},
+	}
+	if err := tasks.Expand(); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	expected := []CopilotInput{
+		{ID: "migrate-auth", LogFile: "logs/migrate-auth.jsonl", Cwd: filepath.Join(root, "services", "auth")},
+		{ID: "migrate-billing", LogFile: "logs/migrate-billing.jsonl", Cwd: filepath.Join(root, "services", "billing")},
+		{ID: "migrate-auth-2", LogFile: "logs/migrate-auth-2.jsonl", Cwd: filepath.Join(root, "libs", "auth")},
+		{ID: "changelog", LogFile: "changelog.jsonl", Cwd: root},
+	}
+	if len(tasks.Tasks) != len(expected) {
+		t.Fatalf("Expected %d tasks, got %d", len(expected), len(tasks.Tasks))
+	}
+	for i, task := range tasks.Tasks {
+		if task.ID != expected[i].ID || task.LogFile != expected[i].LogFile || task.Cwd != expected[i].Cwd || task.Targets != nil {
+			t.Fatalf("Expected task %v, got %v", expected[i], task)
+		}
+	}
+	if !slices.Equal(tasks.Tasks[3].DependsOn, []string{"migrate-auth", "migrate-billing", "migrate-auth-2"}) {
+		t.Fatalf("Expected the dependency to be replaced by all of its targets, got %v", tasks.Tasks[3].DependsOn)
+	}
+	if err := tasks.Validate(); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+
+	tasks = CopilotTasks{Tasks: []CopilotInput{{Targets: []string{filepath.Join(root, "apps", "*")}}}}
+	err := tasks.Expand()
+	if err == nil || err.Error() != fmt.Sprintf("target %s does not match any directory", filepath.Join(root, "apps", "*")) {
+		t.Fatalf("Expected an error for a target without directories, got %v", err)
+	}
+}
+
+func TestExpandModels(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"auth", "billing"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks := CopilotTasks{
+		Tasks: []CopilotInput{
+			{ID: "refactor", LogFile: "refactor.jsonl", Cwd: root, Targets: []string{"*"}, AiModels: []string{"gpt-5", "claude sonnet/4.5"}},
+			{ID: "docs", LogFile: "docs.jsonl", Cwd: root, DependsOn: []string{"refactor"}},
+		},
+	}
+	if err := tasks.Expand(); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	expected := []CopilotInput{
+		{ID: "refactor-auth-gpt-5", LogFile: "refactor-auth-gpt-5.jsonl", Cwd: filepath.Join(root, "auth"), AiModel: "gpt-5", Isolation: IsolationWorktree, Comparison: "refactor-auth-comparison.json"},
+		{ID: "refactor-auth-claude-sonnet-4.5", LogFile: "refactor-auth-claude-sonnet-4.5.jsonl", Cwd: filepath.Join(root, "auth"), AiModel: "claude sonnet/4.5", Isolation: IsolationWorktree, Comparison: "refactor-auth-comparison.json"},
+		{ID: "refactor-billing-gpt-5", LogFile: "refactor-billing-gpt-5.jsonl", Cwd: filepath.Join(root, "billing"), AiModel: "gpt-5", Isolation: IsolationWorktree, Comparison: "refactor-billing-comparison.json"},
+		{ID: "refactor-billing-claude-sonnet-4.5", LogFile: "refactor-billing-claude-sonnet-4.5.jsonl", Cwd: filepath.Join(root, "billing"), AiModel: "claude sonnet/4.5", Isolation: IsolationWorktree, Comparison: "refactor-billing-comparison.json"},
+		{ID: "docs", LogFile: "docs.jsonl", Cwd: root},
+	}
+	if len(tasks.Tasks) != len(expected) {
+		t.Fatalf("Expected %d tasks, got %d", len(expected), len(tasks.Tasks))
+	}
+	for i, task := range tasks.Tasks {
+		if task.ID != expected[i].ID || task.LogFile != expected[i].LogFile || task.Cwd != expected[i].Cwd || task.AiModel != expected[i].AiModel || task.Isolation != expected[i].Isolation || task.Comparison != expected[i].Comparison || task.AiModels != nil {
+			t.Fatalf("Expected task %v, got %v", expected[i], task)
+		}
+	}
+	if !slices.Equal(tasks.Tasks[4].DependsOn, []string{"refactor-auth-gpt-5", "refactor-auth-claude-sonnet-4.5", "refactor-billing-gpt-5", "refactor-billing-claude-sonnet-4.5"}) {
+		t.Fatalf("Expected the dependency to be replaced by all of its copies, got %v", tasks.Tasks[4].DependsOn)
+	}
+	if err := tasks.Validate(); err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+
+	tasks = CopilotTasks{Tasks: []CopilotInput{{LogFile: "refactor.jsonl", AiModel: "gpt-5", AiModels: []string{"gpt-5"}}}}
+	if err := tasks.Expand(); err == nil || err.Error() != "cannot use both ai_model and ai_models within the same task" {
+		t.Fatalf("Expected an error when using both ai_model and ai_models, got %v", err)
+	}
+}
+
+func TestCompareModels(t *testing.T) {
+	tasks := []CopilotInput{
+		{LogFile: "refactor-gpt-5.jsonl", AiModel: "gpt-5", Comparison: "refactor-comparison.json"},
+		{LogFile: "docs.jsonl"},
+		{LogFile: "refactor-gpt-4.1.jsonl", AiModel: "gpt-4.1", Comparison: "refactor-comparison.json"},
+	}
+	outcomes := []TaskOutcome{
+		{TaskID: "refactor-gpt-5", WorkflowID: "batch-task-0", Status: TaskSucceeded, Result: &CopilotResult{Duration: time.Minute, InputTokens: 100, OutputTokens: 10, ToolCalls: 3, FilesChanged: []string{"a.go"}, Diff: &CopilotDiff{Files: []FileDiff{{Path: "a.go", Additions: 4, Deletions: 1}, {Path: "b.go", Additions: 2}}, Additions: 6, Deletions: 1}}},
+		{TaskID: "docs", WorkflowID: "batch-task-1", Status: TaskSucceeded, Result: &CopilotResult{}},
+		{TaskID: "refactor-gpt-4.1", WorkflowID: "batch-task-2", Status: TaskFailed, Error: "model is not available"},
+	}
+	comparisons := CompareModels(tasks, outcomes)
+	expected := []ModelRun{
+		{Model: "gpt-5", TaskID: "refactor-gpt-5", WorkflowID: "batch-task-0", Status: TaskSucceeded, LogFile: "refactor-gpt-5.jsonl", Duration: time.Minute, InputTokens: 100, OutputTokens: 10, ToolCalls: 3, FilesChanged: 2, Additions: 6, Deletions: 1},
+		{Model: "gpt-4.1", TaskID: "refactor-gpt-4.1", WorkflowID: "batch-task-2", Status: TaskFailed, Error: "model is not available", LogFile: "refactor-gpt-4.1.jsonl"},
+	}
+	if len(comparisons) != 1 || comparisons[0].Report != "refactor-comparison.json" || !slices.Equal(comparisons[0].Runs, expected) {
+		t.Fatalf("Expected a single comparison with runs %v, got %v", expected, comparisons)
+	}
+	if comparisons := CompareModels(tasks[1:2], outcomes[1:2]); comparisons != nil {
+		t.Fatalf("Expected no comparison, got %v", comparisons)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	result := CopilotResult{FinalMessage: "Done", Turns: 2, ToolCalls: 3, InputTokens: 100, OutputTokens: 10, Duration: time.Minute, FilesChanged: []string{"a.go"}, LogFile: "hello.jsonl"}
+	result.Merge(CopilotResult{FinalMessage: "Changelog updated", Turns: 1, ToolCalls: 1, InputTokens: 50, OutputTokens: 5, Duration: 30 * time.Second, FilesChanged: []string{"a.go", "CHANGELOG.md"}, LogFile: "hello.jsonl"})
+	if result.FinalMessage != "Changelog updated" || result.Turns != 3 || result.ToolCalls != 4 || result.InputTokens != 150 || result.OutputTokens != 15 || result.Duration != 90*time.Second || !slices.Equal(result.FilesChanged, []string{"a.go", "CHANGELOG.md"}) || result.LogFile != "hello.jsonl" {
+		t.Fatalf("Unexpected merged result: %v", result)
+	}
+
+	result.Merge(CopilotResult{Verification: &Verification{Passed: false, Iterations: 2}})
+	result.Merge(CopilotResult{Verification: &Verification{Passed: true, Iterations: 1}})
+	if result.Verification == nil || !result.Verification.Passed || result.Verification.Iterations != 3 {
+		t.Fatalf("Expected the verification to pass after 3 iterations, got %v", result.Verification)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	testCases := []struct {
+		token    string
+		expected string
+	}{
+		{token: "ghp_secret", expected: RedactedToken},
+		{token: "$GITHUB_TOKEN", expected: "$GITHUB_TOKEN"},
+		{token: "$GH_TOKEN", expected: "$GH_TOKEN"},
+		{token: "${MY_TOKEN}", expected: "${MY_TOKEN}"},
+		{token: "${MY_TOKEN:-ghp_secret}", expected: RedactedToken},
+		{token: "file:/run/secrets/token", expected: "file:/run/secrets/token"},
+		{token: "", expected: ""},
+	}
+	for _, tc := range testCases {
+		task := CopilotInput{GitHubToken: tc.token, Prompt: "Fix the tests"}
+		redacted := task.Redacted()
+		if redacted.GitHubToken != tc.expected || redacted.Prompt != task.Prompt {
+			t.Fatalf("Expected token %q to be redacted as %q, got %q", tc.token, tc.expected, redacted.GitHubToken)
+		}
+		if task.GitHubToken != tc.token {
+			t.Fatalf("Expected the original task to be left untouched, got %q", task.GitHubToken)
+		}
+	}
+}
+
+func TestLoadPrompts(t *testing.T) {
+	baseDir := t.TempDir()
+	files := map[string]string{
+		"review.md":  "Review {{.Repo}} on {{.Branch}} for task {{.Name}} in {{.Cwd}} with {{.Model}}.\nFocus on {{.Vars.focus}}.\n",
+		"system.md":  "You are reviewing {{.Vars.language}} code.",
+		"missing.md": "Focus on {{.Vars.missing}}.",
+		"empty.md":   "{{/* nothing */}}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(baseDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		name                 string
+		task                 CopilotInput
+		expectedPrompt       string
+		expectedSystemPrompt string
+		expectedError        string
+	}{
+		{
+			name:                 "relative files",
+			task:                 CopilotInput{ID: "review", Cwd: "/src/api", PromptFile: "review.md", SystemPromptFile: "system.md", Vars: map[string]string{"focus": "errors", "language": "Go"}},
+			expectedPrompt:       "Review api on main for task review in /src/api with gpt-4.1.\nFocus on errors.",
+			expectedSystemPrompt: "You are reviewing Go code.",
+		},
+		{
+			name:           "absolute file",
+			task:           CopilotInput{LogFile: "review.jsonl", AiModel: "gpt-5", PromptFile: filepath.Join(baseDir, "review.md"), Vars: map[string]string{"focus": "tests"}},
+			expectedPrompt: "Review api on main for task review.jsonl in  with gpt-5.\nFocus on tests.",
+		},
+		{
+			name:          "missing variable",
+			task:          CopilotInput{PromptFile: "missing.md"},
+			expectedError: "invalid prompt template " + filepath.Join(baseDir, "missing.md") + ": template: missing.md:1:16: executing \"missing.md\" at <.Vars.missing>: map has no entry for key \"missing\"",
+		},
+		{
+			name:          "empty prompt",
+			task:          CopilotInput{PromptFile: "empty.md"},
+			expectedError: "prompt template " + filepath.Join(baseDir, "empty.md") + " cannot render to an empty prompt",
+		},
+		{
+			name:          "missing file",
+			task:          CopilotInput{PromptFile: "unknown.md"},
+			expectedError: "open " + filepath.Join(baseDir, "unknown.md") + ": no such file or directory",
+		},
+		{
+			name:          "prompt and prompt file",
+			task:          CopilotInput{Prompt: "Review the code", PromptFile: "review.md"},
+			expectedError: "cannot use prompt_file along with prompt or prompts within the same task",
+		},
+		{
+			name:          "system prompt and system prompt file",
+			task:          CopilotInput{SystemPrompt: "You are a reviewer", SystemPromptFile: "system.md"},
+			expectedError: "cannot use both system_prompt and system_prompt_file within the same task",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.task.LoadPrompts(baseDir, "api", "main")
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Not expecting an error, got %s", err.Error())
+			}
+			if tc.task.Prompt != tc.expectedPrompt || tc.task.SystemPrompt != tc.expectedSystemPrompt {
+				t.Fatalf("Expected prompts %q and %q, got %q and %q", tc.expectedPrompt, tc.expectedSystemPrompt, tc.task.Prompt, tc.task.SystemPrompt)
+			}
+		})
+	}
+}
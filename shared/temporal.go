@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"go.temporal.io/sdk/client"
+)
+
+type TemporalConfig struct {
+	Address   string `json:"address" yaml:"address" toml:"address"`
+	Namespace string `json:"namespace" yaml:"namespace" toml:"namespace"`
+	TLSCert   string `json:"tls_cert" yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey    string `json:"tls_key" yaml:"tls_key" toml:"tls_key"`
+	APIKey    string `json:"api_key" yaml:"api_key" toml:"api_key"`
+}
+
+func TemporalConfigFromEnv() TemporalConfig {
+	return TemporalConfig{
+		Address:   os.Getenv("TEMPORAL_ADDRESS"),
+		Namespace: os.Getenv("TEMPORAL_NAMESPACE"),
+		TLSCert:   os.Getenv("TEMPORAL_TLS_CERT"),
+		TLSKey:    os.Getenv("TEMPORAL_TLS_KEY"),
+		APIKey:    os.Getenv("TEMPORAL_API_KEY"),
+	}
+}
+
+// Merge overrides the settings of the configuration with the non-empty ones of other.
+func (t *TemporalConfig) Merge(other TemporalConfig) {
+	if other.Address != "" {
+		t.Address = other.Address
+	}
+	if other.Namespace != "" {
+		t.Namespace = other.Namespace
+	}
+	if other.TLSCert != "" {
+		t.TLSCert = other.TLSCert
+	}
+	if other.TLSKey != "" {
+		t.TLSKey = other.TLSKey
+	}
+	if other.APIKey != "" {
+		t.APIKey = other.APIKey
+	}
+}
+
+// Interpolate expands the environment variables and file references within the
+// settings read from the config file, reporting every variable that is not set
+// at once. The TLS certificate and key are paths already, so a file: prefix is
+// dropped instead of reading them.
+func (t TemporalConfig) Interpolate(baseDir string) (TemporalConfig, error) {
+	abs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return t, err
+	}
+	in := interpolation{baseDir: abs}
+	t.Address = in.value(reflect.ValueOf(t.Address), "temporal.address").String()
+	t.Namespace = in.value(reflect.ValueOf(t.Namespace), "temporal.namespace").String()
+	t.TLSCert = in.value(reflect.ValueOf(strings.TrimPrefix(t.TLSCert, "file:")), "temporal.tls_cert").String()
+	t.TLSKey = in.value(reflect.ValueOf(strings.TrimPrefix(t.TLSKey, "file:")), "temporal.tls_key").String()
+	t.APIKey = in.value(reflect.ValueOf(t.APIKey), "temporal.api_key").String()
+	return t, in.err()
+}
+
+func (t TemporalConfig) GetNamespace() string {
+	if t.Namespace == "" {
+		return client.DefaultNamespace
+	}
+	return t.Namespace
+}
+
+func (t TemporalConfig) ClientOptions() (client.Options, error) {
+	options := client.Options{HostPort: t.Address, Namespace: t.Namespace}
+	if (t.TLSCert == "") != (t.TLSKey == "") {
+		return options, errors.New("the TLS certificate and key must be set together")
+	}
+	if t.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.TLSCert, t.TLSKey)
+		if err != nil {
+			return options, fmt.Errorf("unable to load the TLS certificate: %s", err.Error())
+		}
+		options.ConnectionOptions.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if t.APIKey != "" {
+		options.Credentials = client.NewAPIKeyStaticCredentials(t.APIKey)
+		// API keys are only accepted over TLS
+		if options.ConnectionOptions.TLS == nil {
+			options.ConnectionOptions.TLS = &tls.Config{}
+		}
+	}
+	return options, nil
+}
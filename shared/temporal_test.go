@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeTemporalConfig(t *testing.T) {
+	config := TemporalConfig{Address: "temporal.internal:7233", Namespace: "multipilot", APIKey: "key"}
+	config.Merge(TemporalConfig{Namespace: "staging", TLSCert: "client.pem", TLSKey: "client.key"})
+	expected := TemporalConfig{Address: "temporal.internal:7233", Namespace: "staging", TLSCert: "client.pem", TLSKey: "client.key", APIKey: "key"}
+	if config != expected {
+		t.Fatalf("Expected %v, got %v", expected, config)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	options, err := TemporalConfig{Address: "temporal.internal:7233", Namespace: "multipilot"}.ClientOptions()
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if options.HostPort != "temporal.internal:7233" || options.Namespace != "multipilot" || options.ConnectionOptions.TLS != nil || options.Credentials != nil {
+		t.Fatalf("Expected plain connection options, got %v", options)
+	}
+
+	options, err = TemporalConfig{APIKey: "key"}.ClientOptions()
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if options.ConnectionOptions.TLS == nil || options.Credentials == nil {
+		t.Fatal("Expected an API key to enable TLS and credentials")
+	}
+
+	testCases := []struct {
+		config        TemporalConfig
+		expectedError string
+	}{
+		{config: TemporalConfig{TLSCert: "client.pem"}, expectedError: "the TLS certificate and key must be set together"},
+		{config: TemporalConfig{TLSCert: filepath.Join(t.TempDir(), "client.pem"), TLSKey: filepath.Join(t.TempDir(), "client.key")}},
+	}
+	for _, tc := range testCases {
+		_, err := tc.config.ClientOptions()
+		if err == nil {
+			t.Fatal("Expected an error, but none gotten")
+		}
+		if tc.expectedError != "" && err.Error() != tc.expectedError {
+			t.Fatalf("Expected error message to be %s, got %s", tc.expectedError, err.Error())
+		}
+	}
+}
+
+func TestInterpolateTemporalConfig(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(baseDir, "api-key"), []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MULTIPILOT_TEMPORAL_KEY", "env-key")
+	t.Setenv("MULTIPILOT_CERTS", "/etc/temporal")
+	testCases := []struct {
+		config        TemporalConfig
+		expected      TemporalConfig
+		expectedError string
+	}{
+		{
+			config:   TemporalConfig{Address: "${MULTIPILOT_TEMPORAL_ADDRESS:-temporal.internal:7233}", APIKey: "${MULTIPILOT_TEMPORAL_KEY}"},
+			expected: TemporalConfig{Address: "temporal.internal:7233", APIKey: "env-key"},
+		},
+		{
+			config:   TemporalConfig{Namespace: "multipilot", APIKey: "file:api-key"},
+			expected: TemporalConfig{Namespace: "multipilot", APIKey: "file-key"},
+		},
+		{
+			config:   TemporalConfig{TLSCert: "${MULTIPILOT_CERTS}/client.pem", TLSKey: "file:${MULTIPILOT_CERTS}/client.key"},
+			expected: TemporalConfig{TLSCert: "/etc/temporal/client.pem", TLSKey: "/etc/temporal/client.key"},
+		},
+		{
+			config:        TemporalConfig{Address: "${MULTIPILOT_TEMPORAL_HOST}:7233", APIKey: "${MULTIPILOT_TEMPORAL_SECRET}"},
+			expectedError: "unresolved environment variables: MULTIPILOT_TEMPORAL_HOST (temporal.address), MULTIPILOT_TEMPORAL_SECRET (temporal.api_key)",
+		},
+	}
+	for _, tc := range testCases {
+		config, err := tc.config.Interpolate(baseDir)
+		if tc.expectedError != "" {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("Expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		if config != tc.expected {
+			t.Fatalf("Expected %v, got %v", tc.expected, config)
+		}
+	}
+}
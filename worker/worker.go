@@ -1,25 +1,56 @@
 package worker
 
 import (
+	"context"
 	"log"
 
+	"github.com/AstraBert/multipilot/shared"
 	"github.com/AstraBert/multipilot/workflow"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
 )
 
-func StartWorker() {
-	c, err := client.Dial(client.Options{})
+type Options struct {
+	Temporal shared.TemporalConfig
+	// MaxConcurrentActivities caps the number of Copilot sessions running at
+	// the same time on this worker (0 means the Temporal default).
+	MaxConcurrentActivities int
+}
+
+func StartWorker(options Options) {
+	clientOptions, err := options.Temporal.ClientOptions()
+	if err != nil {
+		log.Fatalln("Invalid Temporal connection settings.", err)
+	}
+	c, err := client.Dial(clientOptions)
 	if err != nil {
 		log.Fatalln("Unable to create Temporal client.", err)
 	}
 	defer c.Close()
 
-	w := worker.New(c, workflow.CopilotTaskQueue, worker.Options{})
+	// the activities know the task queue of this host, which the follow-up
+	// prompts of their tasks are sent to
+	hostTaskQueue := workflow.HostTaskQueue()
+	activityCtx := workflow.WithHostTaskQueue(context.Background(), hostTaskQueue)
+	w := worker.New(c, workflow.CopilotTaskQueue, worker.Options{
+		MaxConcurrentActivityExecutionSize: options.MaxConcurrentActivities,
+		BackgroundActivityContext:          activityCtx,
+	})
+	hostWorker := worker.New(c, hostTaskQueue, worker.Options{
+		MaxConcurrentActivityExecutionSize: options.MaxConcurrentActivities,
+		BackgroundActivityContext:          activityCtx,
+	})
+	hostWorker.RegisterActivity(workflow.SendPrompt)
+	if err := hostWorker.Start(); err != nil {
+		log.Fatalln("unable to start the worker of the host task queue", err)
+	}
+	defer hostWorker.Stop()
 
 	// This worker hosts both Workflow and Activity functions.
 	w.RegisterWorkflow(workflow.CopilotWorkflow)
+	w.RegisterWorkflow(workflow.BatchWorkflow)
 	w.RegisterActivity(workflow.RunCopilot)
+	w.RegisterActivity(workflow.SendPrompt)
 
 	// Start listening to the Task Queue.
 	err = w.Run(worker.InterruptCh())
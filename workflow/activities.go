@@ -3,41 +3,53 @@ package workflow
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/AstraBert/multipilot/shared"
 	copilot "github.com/github/copilot-sdk/go"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
-func RunCopilot(ctx context.Context, task shared.CopilotInput) error {
+func RunCopilot(ctx context.Context, task shared.CopilotInput) (shared.CopilotResult, error) {
 	recordFile, err := task.GetLogFile()
 	if err != nil {
-		return err
+		return shared.CopilotResult{}, nonRetryableError(shared.ConfigurationError, err)
 	}
-	options := &copilot.ClientOptions{Cwd: task.Cwd, LogLevel: task.LogLevel, Env: task.Env}
-	tok, err := task.GetToken()
+	task, err = task.ResolveSecrets()
 	if err != nil {
-		return err
+		return shared.CopilotResult{}, nonRetryableError(shared.ConfigurationError, err)
 	}
-	if tok != "" {
-		options.GithubToken = tok
+	tracker := newProgressTracker(ctx)
+	task, err = isolate(task, activity.GetInfo(ctx).WorkflowExecution.ID)
+	if err != nil {
+		return shared.CopilotResult{}, err
 	}
-	client := copilot.NewClient(options)
-	if err := client.Start(); err != nil {
-		return fmt.Errorf("an error occurred while starting the client: %s", err.Error())
+	tracker.setIsolation(task)
+	base := snapshotRepository(task.Cwd)
+	if err := checkWorkingTree(task, base, activity.GetInfo(ctx).Attempt); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	if err := runHooks(ctx, task, task.PreHooks, shared.PreHookEvent, recordFile, tracker); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	tracker.setPhase(shared.PhaseStartingClient)
+	client, err := startClient(task)
+	if err != nil {
+		return shared.CopilotResult{}, err
 	}
 	defer client.Stop()
+	defer tracker.keepAlive(client)()
 
-	var model string
-	switch task.AiModel {
-	case "":
-		model = shared.DefaultAiModel
-	default:
-		model = task.AiModel
-	}
+	model := resolveModel(task)
 
 	systemPrompt := &copilot.SystemMessageAppendConfig{}
 
@@ -48,35 +60,459 @@ func RunCopilot(ctx context.Context, task shared.CopilotInput) error {
 		systemPrompt.Content = task.SystemPrompt
 	}
 
-	servers := task.GetMcpServers()
-	mcpServers := make(map[string]copilot.MCPServerConfig)
-	for k, v := range servers {
-		if serverMap, ok := v.(map[string]any); ok {
-			mcpServers[k] = serverMap
-		}
+	if err := validateModel(client, model); err != nil {
+		return shared.CopilotResult{}, err
 	}
 
-	var timeout int64
-	if task.Timeout <= 0 {
-		timeout = shared.DefaultTimeout
-	} else {
-		timeout = task.Timeout
+	info := activity.GetInfo(ctx)
+	sessionId := SessionID(info.WorkflowExecution.ID)
+	if info.Attempt > 1 {
+		// start the retry from a clean conversation
+		_ = client.DeleteSession(sessionId)
 	}
 
 	// Create session
 	session, err := client.CreateSession(&copilot.SessionConfig{
+		SessionID:        sessionId,
 		Model:            model,
 		WorkingDirectory: task.Cwd,
 		ExcludedTools:    task.ExcludeTools,
 		SystemMessage:    (*copilot.SystemMessageConfig)(systemPrompt),
-		MCPServers:       mcpServers,
+		MCPServers:       getMcpServers(task),
 		SkillDirectories: task.Skills,
 	})
 
 	if err != nil {
-		return fmt.Errorf("an error occurred while creating a new session: %s", err.Error())
+		return shared.CopilotResult{}, retryableError(shared.SessionError, fmt.Errorf("an error occurred while creating a new session: %s", err.Error()))
 	}
+	tracker.setPhase(shared.PhaseSessionCreated)
 
+	logEvents(session, recordFile, tracker)
+
+	defer func() { _ = session.Destroy() }()
+
+	for i, turn := range task.GetTurns() {
+		tracker.startTurn(i + 1)
+		if err := sendTurn(ctx, session, recordFile, turn); err != nil {
+			return shared.CopilotResult{}, sessionError(ctx, fmt.Errorf("an error occurred while sending the prompt for turn %d: %s", i+1, err.Error()))
+		}
+		if err := verifyTurn(ctx, task, session, recordFile, turn, tracker); err != nil {
+			return shared.CopilotResult{}, err
+		}
+	}
+	if err := runHooks(ctx, task, task.PostHooks, shared.PostHookEvent, recordFile, tracker); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	result := tracker.finish(task.Cwd, recordFile)
+	result.Diff = recordDiff(task.Cwd, recordFile, base)
+	if err := commitResult(task, activity.GetInfo(ctx).WorkflowExecution.ID, recordFile, &result); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	result.HostTaskQueue = hostTaskQueue(ctx)
+	return result, nil
+}
+
+func SendPrompt(ctx context.Context, task shared.CopilotInput, turn shared.CopilotTurn, base *shared.RepoSnapshot) (shared.CopilotResult, error) {
+	recordFile, err := task.GetLogFile()
+	if err != nil {
+		return shared.CopilotResult{}, nonRetryableError(shared.ConfigurationError, err)
+	}
+	task, err = task.ResolveSecrets()
+	if err != nil {
+		return shared.CopilotResult{}, nonRetryableError(shared.ConfigurationError, err)
+	}
+	tracker := newProgressTracker(ctx)
+	task, err = isolate(task, activity.GetInfo(ctx).WorkflowExecution.ID)
+	if err != nil {
+		return shared.CopilotResult{}, err
+	}
+	tracker.setIsolation(task)
+	tracker.setPhase(shared.PhaseStartingClient)
+	client, err := startClient(task)
+	if err != nil {
+		return shared.CopilotResult{}, err
+	}
+	defer client.Stop()
+	defer tracker.keepAlive(client)()
+
+	session, err := client.ResumeSessionWithOptions(SessionID(activity.GetInfo(ctx).WorkflowExecution.ID), &copilot.ResumeSessionConfig{
+		WorkingDirectory: task.Cwd,
+		MCPServers:       getMcpServers(task),
+		SkillDirectories: task.Skills,
+	})
+	if err != nil {
+		return shared.CopilotResult{}, retryableError(shared.SessionError, fmt.Errorf("an error occurred while resuming the session: %s", err.Error()))
+	}
+	tracker.setPhase(shared.PhaseSessionCreated)
+
+	logEvents(session, recordFile, tracker)
+
+	defer func() { _ = session.Destroy() }()
+
+	tracker.startTurn(1)
+	if err := sendTurn(ctx, session, recordFile, turn); err != nil {
+		return shared.CopilotResult{}, sessionError(ctx, fmt.Errorf("an error occurred while sending the follow-up prompt: %s", err.Error()))
+	}
+	if err := verifyTurn(ctx, task, session, recordFile, turn, tracker); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	if err := runHooks(ctx, task, task.PostHooks, shared.PostHookEvent, recordFile, tracker); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	result := tracker.finish(task.Cwd, recordFile)
+	result.Diff = recordDiff(task.Cwd, recordFile, base)
+	if err := commitResult(task, activity.GetInfo(ctx).WorkflowExecution.ID, recordFile, &result); err != nil {
+		return shared.CopilotResult{}, err
+	}
+	return result, nil
+}
+
+func isolate(task shared.CopilotInput, workflowId string) (shared.CopilotInput, error) {
+	if task.Isolation != shared.IsolationWorktree {
+		return task, nil
+	}
+	if !isGitRepository(task.Cwd) {
+		return task, nonRetryableError(shared.ConfigurationError, fmt.Errorf("worktree isolation requires %s to be within a git repository", task.Cwd))
+	}
+	cwd, err := prepareWorktree(task.Cwd, workflowId)
+	if err != nil {
+		return task, retryableError(shared.GitError, fmt.Errorf("an error occurred while creating the worktree: %s", err.Error()))
+	}
+	task.Cwd = cwd
+	return task, nil
+}
+
+func resolveModel(task shared.CopilotInput) string {
+	if task.AiModel == "" {
+		return shared.DefaultAiModel
+	}
+	return task.AiModel
+}
+
+// checkWorkingTree refuses to start a task that commits its changes on top of
+// uncommitted ones. Retries are not checked, since the working tree contains
+// the changes of the previous attempts.
+func checkWorkingTree(task shared.CopilotInput, base *shared.RepoSnapshot, attempt int32) error {
+	if task.Git == nil {
+		return nil
+	}
+	if base == nil {
+		return nonRetryableError(shared.ConfigurationError, fmt.Errorf("committing the changes requires %s to be within a git repository with at least one commit", task.Cwd))
+	}
+	if attempt > 1 || task.Git.AllowDirty || len(base.DirtyFiles) == 0 {
+		return nil
+	}
+	return nonRetryableError(shared.GitError, fmt.Errorf("the working tree of %s has uncommitted changes (%s), set allow_dirty to commit on top of them", task.Cwd, strings.Join(base.DirtyFiles, ", ")))
+}
+
+func commitResult(task shared.CopilotInput, workflowId, recordFile string, result *shared.CopilotResult) error {
+	if task.Git == nil {
+		return nil
+	}
+	data := shared.GitTemplateData{Name: task.GetName(), WorkflowID: workflowId, Model: resolveModel(task)}
+	branch, err := task.Git.GetBranch(data)
+	if err != nil {
+		return nonRetryableError(shared.ConfigurationError, err)
+	}
+	message, err := task.Git.GetCommitMessage(data)
+	if err != nil {
+		return nonRetryableError(shared.ConfigurationError, err)
+	}
+	commit, err := commitChanges(task.Cwd, branch, message, task.Git.Author)
+	if err != nil {
+		return nonRetryableError(shared.GitError, fmt.Errorf("an error occurred while committing the changes: %s", err.Error()))
+	}
+	result.Branch = branch
+	if commit == "" {
+		log.Printf("No changes to commit on branch %s\n", branch)
+		return nil
+	}
+	result.Commit = commit
+	event := shared.CopilotEvent{
+		ID:        "git-commit-" + commit,
+		Timestamp: time.Now(),
+		Type:      shared.GitCommitEvent,
+		Data:      map[string]any{"branch": branch, "commit": commit, "message": message},
+	}
+	if err := appendRecord(recordFile, event); err != nil {
+		log.Printf("An error occurred while writing the commit to the log file: %s\n", err.Error())
+	}
+	return nil
+}
+
+func recordDiff(cwd, recordFile string, base *shared.RepoSnapshot) *shared.CopilotDiff {
+	if base == nil {
+		return nil
+	}
+	patch, files, err := diffRepository(cwd, *base)
+	if err != nil {
+		log.Printf("An error occurred while computing the diff of the task: %s\n", err.Error())
+		return nil
+	}
+	diff := &shared.CopilotDiff{Base: *base, Files: files, PatchFile: shared.DiffFile(recordFile)}
+	for _, file := range files {
+		diff.Additions += file.Additions
+		diff.Deletions += file.Deletions
+	}
+	if err := os.WriteFile(diff.PatchFile, []byte(patch), 0644); err != nil {
+		log.Printf("An error occurred while writing the diff of the task: %s\n", err.Error())
+		diff.PatchFile = ""
+	}
+	return diff
+}
+
+func SessionID(workflowId string) string {
+	return "session-" + workflowId
+}
+
+type hostTaskQueueKey struct{}
+
+// HostTaskQueue returns the task queue polled by the workers of this host only:
+// the follow-up prompts of a task are sent to it, since they resume the session
+// and reuse the worktree that the host stores locally.
+func HostTaskQueue() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("Unable to get the hostname, follow-up prompts are delivered to this worker only: %s\n", err.Error())
+		hostname = uuid.New().String()
+	}
+	return CopilotTaskQueue + "-" + hostname
+}
+
+// WithHostTaskQueue stores the task queue of the host in the context the worker
+// passes to its activities.
+func WithHostTaskQueue(ctx context.Context, taskQueue string) context.Context {
+	return context.WithValue(ctx, hostTaskQueueKey{}, taskQueue)
+}
+
+func hostTaskQueue(ctx context.Context) string {
+	taskQueue, _ := ctx.Value(hostTaskQueueKey{}).(string)
+	return taskQueue
+}
+
+func startClient(task shared.CopilotInput) (*copilot.Client, error) {
+	options := &copilot.ClientOptions{Cwd: task.Cwd, LogLevel: task.LogLevel, Env: task.Env}
+	tok, err := task.GetToken()
+	if err != nil {
+		return nil, nonRetryableError(shared.AuthenticationError, err)
+	}
+	if tok != "" {
+		options.GithubToken = tok
+	}
+	client := copilot.NewClient(options)
+	if err := client.Start(); err != nil {
+		return nil, retryableError(shared.ClientError, fmt.Errorf("an error occurred while starting the client: %s", err.Error()))
+	}
+	// an older CLI might not report the authentication status: in that case, let the session fail later
+	if status, err := client.GetAuthStatus(); err == nil && !status.IsAuthenticated {
+		client.Stop()
+		message := "unknown reason"
+		if status.StatusMessage != nil {
+			message = *status.StatusMessage
+		}
+		return nil, nonRetryableError(shared.AuthenticationError, fmt.Errorf("the Copilot CLI is not authenticated: %s", message))
+	}
+	return client, nil
+}
+
+func changedFiles(cwd string) []string {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = cwd
+	output, err := cmd.Output()
+	if err != nil {
+		// not a git repository, or git is not available
+		return nil
+	}
+	files := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		file := line[3:]
+		if _, renamed, ok := strings.Cut(file, " -> "); ok {
+			file = renamed
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func validateModel(client *copilot.Client, model string) error {
+	models, err := client.ListModels()
+	if err != nil {
+		log.Printf("Unable to list the available models, skipping model validation: %s\n", err.Error())
+		return nil
+	}
+	available := make([]string, 0, len(models))
+	for _, m := range models {
+		if m.ID == model {
+			return nil
+		}
+		available = append(available, m.ID)
+	}
+	return nonRetryableError(shared.InvalidModelError, fmt.Errorf("model %s is not available, available models are: %s", model, strings.Join(available, ", ")))
+}
+
+func nonRetryableError(errorType string, err error) error {
+	return temporal.NewNonRetryableApplicationError(err.Error(), errorType, err)
+}
+
+func retryableError(errorType string, err error) error {
+	return temporal.NewApplicationErrorWithCause(err.Error(), errorType, err)
+}
+
+// sessionError wraps an error of the session, unless the activity was canceled
+// or timed out: Temporal only reports them as such when ctx.Err() is returned.
+func sessionError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return retryableError(shared.SessionError, err)
+}
+
+func getMcpServers(task shared.CopilotInput) map[string]copilot.MCPServerConfig {
+	servers := task.GetMcpServers()
+	mcpServers := make(map[string]copilot.MCPServerConfig)
+	for k, v := range servers {
+		if serverMap, ok := v.(map[string]any); ok {
+			mcpServers[k] = serverMap
+		}
+	}
+	return mcpServers
+}
+
+type progressTracker struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	progress shared.CopilotProgress
+	result   shared.CopilotResult
+	started  time.Time
+}
+
+func newProgressTracker(ctx context.Context) *progressTracker {
+	tracker := &progressTracker{ctx: ctx, started: time.Now()}
+	if activity.HasHeartbeatDetails(ctx) {
+		var previous shared.CopilotProgress
+		if err := activity.GetHeartbeatDetails(ctx, &previous); err == nil {
+			log.Printf("Previous attempt stopped in phase %s after %d events (last: %s)\n", previous.Phase, previous.EventCount, previous.LastEventType)
+		}
+	}
+	return tracker
+}
+
+func (p *progressTracker) setIsolation(task shared.CopilotInput) {
+	if task.Isolation != shared.IsolationWorktree {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result.Worktree = task.Cwd
+	p.result.Branch = WorktreeBranch(activity.GetInfo(p.ctx).WorkflowExecution.ID)
+}
+
+func (p *progressTracker) setPhase(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Phase = phase
+	activity.RecordHeartbeat(p.ctx, p.progress)
+}
+
+func (p *progressTracker) startTurn(turn int) {
+	p.mu.Lock()
+	p.progress.Turn = turn
+	p.result.Turns += 1
+	p.mu.Unlock()
+	p.setPhase(shared.PhaseWaitingOnModel)
+}
+
+func (p *progressTracker) startIteration() {
+	p.mu.Lock()
+	if p.result.Verification == nil {
+		p.result.Verification = &shared.Verification{}
+	}
+	p.result.Verification.Iterations += 1
+	p.mu.Unlock()
+	p.setPhase(shared.PhaseWaitingOnModel)
+}
+
+func (p *progressTracker) setVerification(passed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.result.Verification == nil {
+		p.result.Verification = &shared.Verification{}
+	}
+	p.result.Verification.Passed = passed
+}
+
+func (p *progressTracker) observe(event copilot.SessionEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.EventCount += 1
+	p.progress.LastEventType = string(event.Type)
+	switch event.Type {
+	case copilot.ToolExecutionStart:
+		p.progress.Phase = shared.PhaseToolRunning
+		p.result.ToolCalls += 1
+	case copilot.ToolExecutionComplete, copilot.AssistantTurnStart:
+		p.progress.Phase = shared.PhaseWaitingOnModel
+	case copilot.AssistantMessage:
+		if event.Data.Content != nil && *event.Data.Content != "" {
+			p.result.FinalMessage = *event.Data.Content
+		}
+	case copilot.AssistantUsage:
+		if event.Data.InputTokens != nil {
+			p.result.InputTokens += int64(*event.Data.InputTokens)
+		}
+		if event.Data.OutputTokens != nil {
+			p.result.OutputTokens += int64(*event.Data.OutputTokens)
+		}
+	}
+	activity.RecordHeartbeat(p.ctx, p.progress)
+}
+
+func (p *progressTracker) finish(cwd, logFile string) shared.CopilotResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result.Duration = time.Since(p.started)
+	p.result.FilesChanged = changedFiles(cwd)
+	p.result.LogFile = logFile
+	return p.result
+}
+
+func (p *progressTracker) heartbeat() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	activity.RecordHeartbeat(p.ctx, p.progress)
+}
+
+// keepAlive heartbeats while the Copilot CLI answers pings, so that long tool
+// executions that emit no events are not mistaken for a dead session.
+func (p *progressTracker) keepAlive(client *copilot.Client) func() {
+	interval := activity.GetInfo(p.ctx).HeartbeatTimeout / 3
+	done := make(chan struct{})
+	if interval <= 0 {
+		return func() {}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := client.Ping(""); err != nil {
+					log.Printf("The Copilot CLI did not answer the ping: %s\n", err.Error())
+					continue
+				}
+				p.heartbeat()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func logEvents(session *copilot.Session, recordFile string, tracker *progressTracker) {
 	seenIds := make(map[string]int8)
 
 	session.On(func(event copilot.SessionEvent) {
@@ -85,50 +521,99 @@ func RunCopilot(ctx context.Context, task shared.CopilotInput) error {
 			return
 		}
 		seenIds[event.ID] = 0
-		toWrite, err := serializeEvent(event)
-		if err != nil {
-			log.Printf("An error occurred while converting session event to log: %s\n", err.Error())
-			return
-		}
-		f, err := os.OpenFile(recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("An error occurred while opening the log file: %s\n", err.Error())
-			return
-		}
-		defer func() { _ = f.Close() }()
-		if _, err = f.WriteString(toWrite + "\n"); err != nil {
-			log.Printf("An error occurred while writing to the log file: %s\n", err.Error())
-			return
+		tracker.observe(event)
+		if err := appendEvent(recordFile, event); err != nil {
+			log.Printf("An error occurred while writing the session event to the log file: %s\n", err.Error())
 		}
 	})
+}
 
-	defer func() { _ = session.Destroy() }()
-
-	response, err := session.SendAndWait(copilot.MessageOptions{Prompt: task.Prompt}, time.Duration(timeout)*time.Second)
-	if err != nil {
-		log.Printf("An error occurred while sending prompt to session: %s", err.Error())
+// sendTurn sends the prompt and waits for the session to be idle. If the
+// activity is canceled in the meantime, the in-flight request is aborted.
+func sendTurn(ctx context.Context, session *copilot.Session, recordFile string, turn shared.CopilotTurn) error {
+	if ctx.Err() != nil {
+		abortSession(nil, recordFile, ctx.Err())
+		return ctx.Err()
 	}
-
-	if response != nil {
-		toWrite, err := serializeEvent(*response)
-		if err != nil {
-			log.Printf("An error occurred while converting session event to log: %s\n", err.Error())
-			return err
-		}
-		f, err := os.OpenFile(recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("An error occurred while opening the log file: %s\n", err.Error())
-			return err
+	type reply struct {
+		response *copilot.SessionEvent
+		err      error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		response, err := session.SendAndWait(copilot.MessageOptions{Prompt: turn.Prompt}, time.Duration(turn.Timeout)*time.Second)
+		replies <- reply{response: response, err: err}
+	}()
+	var response *copilot.SessionEvent
+	select {
+	case <-ctx.Done():
+		abortSession(session, recordFile, ctx.Err())
+		return ctx.Err()
+	case r := <-replies:
+		if r.err != nil {
+			log.Printf("An error occurred while sending prompt to session: %s", r.err.Error())
+			return r.err
 		}
-		defer func() { _ = f.Close() }()
-		if _, err = f.WriteString(toWrite + "\n"); err != nil {
-			log.Printf("An error occurred while writing to the log file: %s\n", err.Error())
+		response = r.response
+	}
+	if response != nil {
+		if err := appendEvent(recordFile, *response); err != nil {
+			log.Printf("An error occurred while writing the response to the log file: %s\n", err.Error())
 			return err
 		}
 	}
 	return nil
 }
 
+// abortSession stops the in-flight request of the session, if any, and records
+// why the session ended so that it shows up when rendering the log file.
+func abortSession(session *copilot.Session, recordFile string, cause error) {
+	if session != nil {
+		if err := session.Abort(); err != nil {
+			log.Printf("An error occurred while aborting the session: %s\n", err.Error())
+		}
+	}
+	reason := "the task was canceled"
+	if errors.Is(cause, context.DeadlineExceeded) {
+		reason = "the task timed out"
+	}
+	event := shared.CopilotEvent{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Type:      shared.AbortEvent,
+		Data:      map[string]any{"reason": reason},
+	}
+	if err := appendRecord(recordFile, event); err != nil {
+		log.Printf("An error occurred while writing the abort event to the log file: %s\n", err.Error())
+	}
+}
+
+func appendEvent(recordFile string, event copilot.SessionEvent) error {
+	toWrite, err := serializeEvent(event)
+	if err != nil {
+		return err
+	}
+	return appendLine(recordFile, toWrite)
+}
+
+func appendRecord(recordFile string, event shared.CopilotEvent) error {
+	serialized, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return appendLine(recordFile, string(serialized))
+}
+
+func appendLine(recordFile, toWrite string) error {
+	f, err := os.OpenFile(recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = f.WriteString(toWrite + "\n")
+	return err
+}
+
 func serializeEvent(event copilot.SessionEvent) (string, error) {
 	transformed := shared.CopilotEvent{ID: event.ID, Timestamp: event.Timestamp, Type: string(event.Type), Data: make(map[string]any)}
 	content, err := json.Marshal(event.Data)
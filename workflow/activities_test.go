@@ -1,7 +1,13 @@
 package workflow
 
 import (
+	"context"
 	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -46,3 +52,62 @@ func TestSerializeEvent(t *testing.T) {
 		t.Fatal("Expected copilotVersion not to be in the transformed event data because is null, but it is")
 	}
 }
+
+func TestChangedFiles(t *testing.T) {
+	notRepo := t.TempDir()
+	if files := changedFiles(notRepo); files != nil {
+		t.Fatalf("Expected no changed files outside of a git repository, got %v", files)
+	}
+	repo := t.TempDir()
+	if err := exec.Command("git", "-C", repo, "init").Run(); err != nil {
+		t.Skipf("git is not available: %s", err.Error())
+	}
+	files := changedFiles(repo)
+	if files == nil || len(files) != 0 {
+		t.Fatalf("Expected an empty list of changed files, got %v", files)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "hello.go"), []byte("package hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files = changedFiles(repo)
+	if !slices.Equal(files, []string{"hello.go"}) {
+		t.Fatalf("Expected [hello.go] as changed files, got %v", files)
+	}
+}
+
+func TestAbortSession(t *testing.T) {
+	recordFile := filepath.Join(t.TempDir(), "log.jsonl")
+	abortSession(nil, recordFile, context.Canceled)
+	abortSession(nil, recordFile, context.DeadlineExceeded)
+	content, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	reasons := []any{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var event shared.CopilotEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Not expecting an error, got %s", err.Error())
+		}
+		if event.Type != shared.AbortEvent {
+			t.Fatalf("Expected an %s event, got %s", shared.AbortEvent, event.Type)
+		}
+		reasons = append(reasons, event.Data["reason"])
+	}
+	if expected := []any{"the task was canceled", "the task timed out"}; !slices.Equal(reasons, expected) {
+		t.Fatalf("Expected reasons %v, got %v", expected, reasons)
+	}
+}
+
+func TestHostTaskQueue(t *testing.T) {
+	if queue := HostTaskQueue(); !strings.HasPrefix(queue, CopilotTaskQueue+"-") {
+		t.Fatalf("Expected the host task queue to start with %s-, got %s", CopilotTaskQueue, queue)
+	}
+	if queue := hostTaskQueue(context.Background()); queue != "" {
+		t.Fatalf("Expected no host task queue outside of a worker, got %s", queue)
+	}
+	ctx := WithHostTaskQueue(context.Background(), "copilot-task-queue-host1")
+	if queue := hostTaskQueue(ctx); queue != "copilot-task-queue-host1" {
+		t.Fatalf("Expected the host task queue to be copilot-task-queue-host1, got %s", queue)
+	}
+}
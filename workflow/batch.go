@@ -0,0 +1,187 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AstraBert/multipilot/shared"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+func BatchWorkflow(ctx workflow.Context, tasks shared.CopilotTasks) (shared.BatchResult, error) {
+	if err := tasks.Validate(); err != nil {
+		return shared.BatchResult{}, err
+	}
+
+	batchId := workflow.GetInfo(ctx).WorkflowExecution.ID
+	ids := make(map[string]int)
+	for i, task := range tasks.Tasks {
+		if task.ID != "" {
+			ids[task.ID] = i
+		}
+	}
+
+	outcomes := make([]shared.TaskOutcome, len(tasks.Tasks))
+	started := make([]bool, len(tasks.Tasks))
+	for i, task := range tasks.Tasks {
+		outcomes[i] = shared.TaskOutcome{TaskID: task.GetName(), WorkflowID: ChildWorkflowID(batchId, i), LogFile: task.LogFile}
+	}
+
+	err := workflow.SetQueryHandler(ctx, StatusQuery, func() (shared.BatchStatus, error) {
+		status := shared.BatchStatus{BatchID: batchId, MaxParallel: tasks.MaxParallel, Tasks: make([]shared.TaskOutcome, len(outcomes))}
+		copy(status.Tasks, outcomes)
+		for i := range status.Tasks {
+			switch {
+			case status.Tasks[i].Status != "":
+			case started[i]:
+				status.Tasks[i].Status = shared.TaskRunning
+			default:
+				status.Tasks[i].Status = shared.TaskPending
+			}
+		}
+		return status, nil
+	})
+	if err != nil {
+		return shared.BatchResult{}, err
+	}
+
+	selector := workflow.NewSelector(ctx)
+	running := 0
+
+	for {
+		// Keep scheduling until no more tasks can be started or skipped, since
+		// skipping a task can make its own dependents skippable.
+		progress := true
+		for progress {
+			progress = false
+			for i, task := range tasks.Tasks {
+				if started[i] {
+					continue
+				}
+				ready := true
+				failedDep := ""
+				for _, dep := range task.DependsOn {
+					switch outcomes[ids[dep]].Status {
+					case "":
+						ready = false
+					case shared.TaskFailed, shared.TaskSkipped:
+						failedDep = dep
+					}
+				}
+				if failedDep != "" {
+					started[i] = true
+					outcomes[i].Status = shared.TaskSkipped
+					outcomes[i].Error = fmt.Sprintf("skipped because dependency %s did not succeed", failedDep)
+					progress = true
+					continue
+				}
+				if ctx.Err() != nil {
+					started[i] = true
+					outcomes[i].Status = shared.TaskSkipped
+					outcomes[i].Error = "skipped because the batch was canceled"
+					progress = true
+					continue
+				}
+				if !ready {
+					continue
+				}
+				// the task stays pending until a running task completes
+				if tasks.MaxParallel > 0 && running >= tasks.MaxParallel {
+					continue
+				}
+				started[i] = true
+				running += 1
+				childCtx := workflow.WithChildOptions(ctx, childOptions(tasks, task, outcomes[i].WorkflowID))
+				future := workflow.ExecuteChildWorkflow(childCtx, CopilotWorkflow, task)
+				selector.AddFuture(future, func(f workflow.Future) {
+					running -= 1
+					var result shared.CopilotResult
+					if err := f.Get(ctx, &result); err != nil {
+						outcomes[i].Status = shared.TaskFailed
+						outcomes[i].Error, outcomes[i].ErrorType = describeError(err)
+						return
+					}
+					outcomes[i].Status = shared.TaskSucceeded
+					outcomes[i].Result = &result
+				})
+			}
+		}
+		if running == 0 {
+			break
+		}
+		selector.Select(ctx)
+	}
+
+	result := shared.BatchResult{BatchID: batchId, Tasks: outcomes, Comparisons: shared.CompareModels(tasks.Tasks, outcomes)}
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case shared.TaskSucceeded:
+			result.Succeeded += 1
+		case shared.TaskSkipped:
+			result.Skipped += 1
+		default:
+			result.Failed += 1
+		}
+	}
+	return result, nil
+}
+
+// Search attributes set on the workflow of each task when search_attributes is
+// enabled. They have to be registered on the namespace beforehand.
+var (
+	TaskNameAttribute = temporal.NewSearchAttributeKeyKeyword("MultipilotTaskName")
+	CwdAttribute      = temporal.NewSearchAttributeKeyKeyword("MultipilotCwd")
+	ModelAttribute    = temporal.NewSearchAttributeKeyKeyword("MultipilotModel")
+)
+
+// childOptions starts the workflow of a task with a memo, and search attributes
+// if enabled, so that list and describe can show it without decoding its input.
+func childOptions(tasks shared.CopilotTasks, task shared.CopilotInput, workflowID string) workflow.ChildWorkflowOptions {
+	options := workflow.ChildWorkflowOptions{
+		WorkflowID: workflowID,
+		TaskQueue:  CopilotTaskQueue,
+		Memo:       TaskMemo(task),
+	}
+	if tasks.SearchAttributes {
+		options.TypedSearchAttributes = TaskSearchAttributes(task)
+	}
+	return options
+}
+
+func TaskMemo(task shared.CopilotInput) map[string]interface{} {
+	return map[string]interface{}{
+		shared.MemoTaskName: task.GetName(),
+		shared.MemoCwd:      task.Cwd,
+		shared.MemoModel:    resolveModel(task),
+		shared.MemoLogFile:  task.LogFile,
+	}
+}
+
+func TaskSearchAttributes(task shared.CopilotInput) temporal.SearchAttributes {
+	return temporal.NewSearchAttributes(
+		TaskNameAttribute.ValueSet(task.GetName()),
+		CwdAttribute.ValueSet(task.Cwd),
+		ModelAttribute.ValueSet(resolveModel(task)),
+	)
+}
+
+func ChildWorkflowID(batchId string, index int) string {
+	return fmt.Sprintf("%s-task-%d", batchId, index)
+}
+
+func describeError(err error) (string, string) {
+	var applicationErr *temporal.ApplicationError
+	if errors.As(err, &applicationErr) {
+		return applicationErr.Message(), applicationErr.Type()
+	}
+	var timeoutErr *temporal.TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr.Error(), "TimeoutError"
+	}
+	var canceledErr *temporal.CanceledError
+	if errors.As(err, &canceledErr) {
+		return canceledErr.Error(), "CanceledError"
+	}
+	return err.Error(), ""
+}
@@ -0,0 +1,177 @@
+package workflow
+
+import (
+	"time"
+
+	"github.com/AstraBert/multipilot/shared"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+func (s *UnitTestSuite) Test_BatchWorkflow_AllSucceed() {
+	s.env.OnWorkflow(CopilotWorkflow, mock.Anything, mock.Anything).Return(shared.CopilotResult{Turns: 1}, nil)
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		Tasks: []shared.CopilotInput{
+			{LogFile: "hello.jsonl", Cwd: "/test/hello"},
+			{LogFile: "hello1.jsonl", Cwd: "/test/hello1"},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result shared.BatchResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.Len(result.Tasks, 2)
+	s.Equal(2, result.Succeeded)
+	for i, outcome := range result.Tasks {
+		s.Equal(shared.TaskSucceeded, outcome.Status)
+		s.Equal(ChildWorkflowID(result.BatchID, i), outcome.WorkflowID)
+		s.Equal(1, outcome.Result.Turns)
+	}
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_RespectsDependencies() {
+	order := []string{}
+	s.env.OnWorkflow(CopilotWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, input shared.CopilotInput) (shared.CopilotResult, error) {
+			order = append(order, input.ID)
+			return shared.CopilotResult{}, nil
+		})
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		Tasks: []shared.CopilotInput{
+			{ID: "frontend", LogFile: "frontend.jsonl", Cwd: "/test/frontend", DependsOn: []string{"backend"}},
+			{ID: "backend", LogFile: "backend.jsonl", Cwd: "/test/backend"},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.Equal([]string{"backend", "frontend"}, order)
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_LimitsParallelTasks() {
+	running, maxRunning := 0, 0
+	s.env.OnWorkflow(CopilotWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, input shared.CopilotInput) (shared.CopilotResult, error) {
+			running += 1
+			maxRunning = max(maxRunning, running)
+			err := workflow.Sleep(ctx, time.Minute)
+			running -= 1
+			return shared.CopilotResult{}, err
+		})
+	s.env.RegisterDelayedCallback(func() {
+		response, err := s.env.QueryWorkflow(StatusQuery)
+		s.NoError(err)
+		var status shared.BatchStatus
+		s.NoError(response.Get(&status))
+		s.Equal(2, status.MaxParallel)
+		s.Equal(2, status.Count(shared.TaskRunning))
+		s.Equal(1, status.Count(shared.TaskPending))
+		s.Equal(shared.TaskPending, status.Tasks[2].Status)
+	}, 30*time.Second)
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		MaxParallel: 2,
+		Tasks: []shared.CopilotInput{
+			{LogFile: "hello.jsonl", Cwd: "/test/hello"},
+			{LogFile: "hello1.jsonl", Cwd: "/test/hello1"},
+			{LogFile: "hello2.jsonl", Cwd: "/test/hello2"},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result shared.BatchResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.Equal(3, result.Succeeded)
+	s.Equal(2, maxRunning)
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_SkipsDependentsOfFailedTasks() {
+	s.env.OnWorkflow(CopilotWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, input shared.CopilotInput) (shared.CopilotResult, error) {
+			if input.ID == "backend" {
+				return shared.CopilotResult{}, temporal.NewNonRetryableApplicationError("activity failure", shared.AuthenticationError, nil)
+			}
+			return shared.CopilotResult{}, nil
+		})
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		Tasks: []shared.CopilotInput{
+			{ID: "backend", LogFile: "backend.jsonl", Cwd: "/test/backend"},
+			{ID: "frontend", LogFile: "frontend.jsonl", Cwd: "/test/frontend", DependsOn: []string{"backend"}},
+			{ID: "e2e", LogFile: "e2e.jsonl", Cwd: "/test/e2e", DependsOn: []string{"frontend"}},
+			{ID: "docs", LogFile: "docs.jsonl", Cwd: "/test/docs"},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result shared.BatchResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.Equal(1, result.Succeeded)
+	s.Equal(1, result.Failed)
+	s.Equal(2, result.Skipped)
+	outcomes := result.Tasks
+	s.Equal(shared.TaskFailed, outcomes[0].Status)
+	s.Equal("activity failure", outcomes[0].Error)
+	s.Equal(shared.AuthenticationError, outcomes[0].ErrorType)
+	s.Equal(shared.TaskSkipped, outcomes[1].Status)
+	s.Equal("skipped because dependency backend did not succeed", outcomes[1].Error)
+	s.Equal(shared.TaskSkipped, outcomes[2].Status)
+	s.Equal("skipped because dependency frontend did not succeed", outcomes[2].Error)
+	s.Equal(shared.TaskSucceeded, outcomes[3].Status)
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_InvalidTasks() {
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		Tasks: []shared.CopilotInput{
+			{ID: "a", LogFile: "a.jsonl", Cwd: "/test/a", DependsOn: []string{"b"}},
+			{ID: "b", LogFile: "b.jsonl", Cwd: "/test/b", DependsOn: []string{"a"}},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_CancelSkipsPendingTasks() {
+	s.env.OnWorkflow(CopilotWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, input shared.CopilotInput) (shared.CopilotResult, error) {
+			return shared.CopilotResult{}, workflow.Sleep(ctx, time.Hour)
+		})
+	s.env.RegisterDelayedCallback(func() {
+		s.env.CancelWorkflow()
+	}, time.Minute)
+	s.env.ExecuteWorkflow(BatchWorkflow, shared.CopilotTasks{
+		MaxParallel: 1,
+		Tasks: []shared.CopilotInput{
+			{LogFile: "hello.jsonl", Cwd: "/test/hello"},
+			{LogFile: "hello1.jsonl", Cwd: "/test/hello1"},
+		},
+	})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result shared.BatchResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	// mocked child workflows are not canceled by the test environment, only
+	// the tasks that did not start yet are checked
+	s.Equal(shared.TaskSkipped, result.Tasks[1].Status)
+	s.Equal("skipped because the batch was canceled", result.Tasks[1].Error)
+}
+
+func (s *UnitTestSuite) Test_BatchWorkflow_ChildOptions() {
+	task := shared.CopilotInput{ID: "backend", LogFile: "backend.jsonl", Cwd: "/test/backend", AiModel: "gpt-5"}
+	options := childOptions(shared.CopilotTasks{Tasks: []shared.CopilotInput{task}}, task, "batch-task-0")
+	s.Equal("batch-task-0", options.WorkflowID)
+	s.Equal(CopilotTaskQueue, options.TaskQueue)
+	s.Equal(map[string]interface{}{shared.MemoTaskName: "backend", shared.MemoCwd: "/test/backend", shared.MemoModel: "gpt-5", shared.MemoLogFile: "backend.jsonl"}, options.Memo)
+	s.Equal(0, options.TypedSearchAttributes.Size())
+
+	options = childOptions(shared.CopilotTasks{Tasks: []shared.CopilotInput{task}, SearchAttributes: true}, task, "batch-task-0")
+	cwd, ok := options.TypedSearchAttributes.GetKeyword(CwdAttribute)
+	s.True(ok)
+	s.Equal("/test/backend", cwd)
+	model, _ := options.TypedSearchAttributes.GetKeyword(ModelAttribute)
+	s.Equal("gpt-5", model)
+}
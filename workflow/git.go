@@ -0,0 +1,207 @@
+package workflow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AstraBert/multipilot/shared"
+)
+
+func WorktreeBranch(workflowId string) string {
+	return "multipilot/" + workflowId
+}
+
+func worktreePath(workflowId string) string {
+	return filepath.Join(os.TempDir(), "multipilot-worktrees", workflowId)
+}
+
+// prepareWorktree returns the directory, within a worktree dedicated to the
+// workflow, that corresponds to cwd. The worktree is created on a new branch
+// the first time, and reused by retries and follow-up prompts.
+func prepareWorktree(cwd, workflowId string) (string, error) {
+	prefix, err := runGit(cwd, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	path := worktreePath(workflowId)
+	if _, err := os.Stat(path); err != nil {
+		branch := WorktreeBranch(workflowId)
+		if _, err := runGit(cwd, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			// a previous attempt created the branch, but its worktree was removed
+			_, err = runGit(cwd, "worktree", "add", path, branch)
+			if err != nil {
+				return "", err
+			}
+		} else if _, err := runGit(cwd, "worktree", "add", "-b", branch, path, "HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(path, prefix), nil
+}
+
+// snapshotRepository records the commit and dirty files of the repository
+// containing dir, or returns nil if dir is not within a repository with commits.
+func snapshotRepository(dir string) *shared.RepoSnapshot {
+	commit, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+	status, err := runGit(dir, "status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return nil
+	}
+	snapshot := &shared.RepoSnapshot{Commit: commit, DirtyFiles: []string{}}
+	for _, line := range strings.Split(status, "\n") {
+		// runGit trims the leading space of the first status line
+		line = strings.TrimSpace(line)
+		if _, file, ok := strings.Cut(line, " "); ok {
+			if _, renamed, ok := strings.Cut(file, " -> "); ok {
+				file = renamed
+			}
+			snapshot.DirtyFiles = append(snapshot.DirtyFiles, strings.TrimSpace(file))
+		}
+	}
+	return snapshot
+}
+
+// diffRepository returns the unified diff between the snapshot commit and the
+// current state of the repository containing dir, untracked files included.
+func diffRepository(dir string, snapshot shared.RepoSnapshot) (string, []shared.FileDiff, error) {
+	root, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, err
+	}
+	patch, err := runGitDiff(root, "diff", "--no-color", "--no-renames", snapshot.Commit)
+	if err != nil {
+		return "", nil, err
+	}
+	numstat, err := runGitDiff(root, "diff", "--numstat", "--no-renames", snapshot.Commit)
+	if err != nil {
+		return "", nil, err
+	}
+	untracked, err := runGit(root, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return "", nil, err
+	}
+	for _, file := range strings.Split(untracked, "\n") {
+		if file == "" {
+			continue
+		}
+		filePatch, err := runGitDiff(root, "diff", "--no-color", "--no-index", "/dev/null", file)
+		if err != nil {
+			return "", nil, err
+		}
+		fileNumstat, err := runGitDiff(root, "diff", "--numstat", "--no-index", "/dev/null", file)
+		if err != nil {
+			return "", nil, err
+		}
+		patch += filePatch
+		numstat += fileNumstat
+	}
+	return patch, parseNumstat(numstat), nil
+}
+
+func parseNumstat(numstat string) []shared.FileDiff {
+	files := []shared.FileDiff{}
+	for _, line := range strings.Split(numstat, "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		// binary files are reported with "-" additions and deletions
+		additions, _ := strconv.Atoi(parts[0])
+		deletions, _ := strconv.Atoi(parts[1])
+		// untracked files are diffed against /dev/null
+		path := strings.TrimPrefix(parts[2], "/dev/null => ")
+		files = append(files, shared.FileDiff{Path: path, Additions: additions, Deletions: deletions})
+	}
+	return files
+}
+
+// commitChanges commits every change within cwd to branch, creating the branch
+// from the current HEAD if needed, and returns the SHA of the new commit, or an
+// empty string if there was nothing to commit.
+func commitChanges(cwd, branch, message, author string) (string, error) {
+	current, err := runGit(cwd, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if current != branch {
+		if _, err := runGit(cwd, "checkout", "-b", branch); err != nil {
+			return "", err
+		}
+	}
+	if _, err := runGit(cwd, "add", "-A", "--", "."); err != nil {
+		return "", err
+	}
+	staged, err := runGit(cwd, "diff", "--cached", "--name-only", "--", ".")
+	if err != nil {
+		return "", err
+	}
+	if staged == "" {
+		return "", nil
+	}
+	args := []string{"commit", "-m", message}
+	if author != "" {
+		args = append(args, "--author", author)
+	}
+	// only commit the changes within cwd, even if other files were staged
+	if _, err := runGit(cwd, append(args, "--", ".")...); err != nil {
+		return "", err
+	}
+	return runGit(cwd, "rev-parse", "HEAD")
+}
+
+// RepositoryInfo returns the name of the git repository containing dir and its
+// current branch, which are empty outside of a repository or on a detached HEAD.
+func RepositoryInfo(dir string) (string, string) {
+	toplevel, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", ""
+	}
+	branch, err := runGit(dir, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		branch = ""
+	}
+	return filepath.Base(toplevel), branch
+}
+
+func isGitRepository(dir string) bool {
+	_, err := runGit(dir, "rev-parse", "--git-dir")
+	return err == nil
+}
+
+// runGitDiff runs a git diff command, for which an exit code of 1 means that
+// differences were found, and returns its untrimmed output.
+func runGitDiff(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()+" "+err.Error()))
+		}
+	}
+	return stdout.String(), nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
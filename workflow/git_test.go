@@ -0,0 +1,211 @@
+package workflow
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AstraBert/multipilot/shared"
+	"go.temporal.io/sdk/temporal"
+)
+
+func initTestRepository(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	commands := [][]string{
+		{"init", "-b", "main"},
+		{"config", "user.name", "multipilot"},
+		{"config", "user.email", "multipilot@example.com"},
+	}
+	for _, args := range commands {
+		if err := exec.Command("git", append([]string{"-C", repo}, args...)...).Run(); err != nil {
+			t.Skipf("git is not available: %s", err.Error())
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "backend"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "backend", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(repo, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(repo, "commit", "-m", "initial commit"); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestPrepareWorktree(t *testing.T) {
+	repo := initTestRepository(t)
+	workflowId := "multipilot-test-" + filepath.Base(repo)
+	t.Cleanup(func() {
+		_, _ = runGit(repo, "worktree", "remove", "--force", worktreePath(workflowId))
+	})
+
+	cwd, err := prepareWorktree(filepath.Join(repo, "backend"), workflowId)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if cwd != filepath.Join(worktreePath(workflowId), "backend") {
+		t.Fatalf("Expected the working directory to be the backend directory within the worktree, got %s", cwd)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "main.go")); err != nil {
+		t.Fatalf("Expected main.go to be checked out in the worktree: %s", err.Error())
+	}
+	branch, err := runGit(cwd, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if branch != WorktreeBranch(workflowId) {
+		t.Fatalf("Expected the worktree to be on branch %s, got %s", WorktreeBranch(workflowId), branch)
+	}
+
+	// retries and follow-ups reuse the same worktree
+	again, err := prepareWorktree(filepath.Join(repo, "backend"), workflowId)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if again != cwd {
+		t.Fatalf("Expected the worktree to be reused, got %s", again)
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	task, err := isolate(shared.CopilotInput{Cwd: "/test/dir"}, "multipilot-123")
+	if err != nil || task.Cwd != "/test/dir" {
+		t.Fatalf("Expected tasks without isolation to be left untouched, got %s and %v", task.Cwd, err)
+	}
+	_, err = isolate(shared.CopilotInput{Cwd: t.TempDir(), Isolation: shared.IsolationWorktree}, "multipilot-123")
+	var applicationErr *temporal.ApplicationError
+	if !errors.As(err, &applicationErr) || applicationErr.Type() != shared.ConfigurationError || !applicationErr.NonRetryable() {
+		t.Fatalf("Expected a non-retryable configuration error outside of a git repository, got %v", err)
+	}
+}
+
+func TestSnapshotAndDiffRepository(t *testing.T) {
+	if snapshot := snapshotRepository(t.TempDir()); snapshot != nil {
+		t.Fatalf("Expected no snapshot outside of a git repository, got %v", snapshot)
+	}
+	repo := initTestRepository(t)
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("# hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := snapshotRepository(filepath.Join(repo, "backend"))
+	if snapshot == nil {
+		t.Fatal("Expected a snapshot of the repository")
+	}
+	head, _ := runGit(repo, "rev-parse", "HEAD")
+	if snapshot.Commit != head || !slices.Equal(snapshot.DirtyFiles, []string{"README.md"}) {
+		t.Fatalf("Expected commit %s and dirty files [README.md], got %s and %v", head, snapshot.Commit, snapshot.DirtyFiles)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "backend", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "backend", "handlers.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patch, files, err := diffRepository(filepath.Join(repo, "backend"), *snapshot)
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	expectedFiles := []shared.FileDiff{
+		{Path: "backend/main.go", Additions: 2, Deletions: 0},
+		{Path: "README.md", Additions: 1, Deletions: 0},
+		{Path: "backend/handlers.go", Additions: 1, Deletions: 0},
+	}
+	if !slices.Equal(files, expectedFiles) {
+		t.Fatalf("Expected files %v, got %v", expectedFiles, files)
+	}
+	if !strings.Contains(patch, "+func main() {}") || !strings.Contains(patch, "b/backend/handlers.go") {
+		t.Fatalf("Expected the patch to contain both the modified and the untracked files, got %s", patch)
+	}
+}
+
+func TestCommitChanges(t *testing.T) {
+	repo := initTestRepository(t)
+	cwd := filepath.Join(repo, "backend")
+	commit, err := commitChanges(cwd, "multipilot/logging", "Apply multipilot task logging", "")
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	if commit != "" {
+		t.Fatalf("Expected no commit without changes, got %s", commit)
+	}
+
+	if err := os.WriteFile(filepath.Join(cwd, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("# hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commit, err = commitChanges(cwd, "multipilot/logging", "Apply multipilot task logging", "Bot <bot@example.com>")
+	if err != nil {
+		t.Fatalf("Not expecting an error, got %s", err.Error())
+	}
+	head, _ := runGit(repo, "rev-parse", "multipilot/logging")
+	if commit == "" || commit != head {
+		t.Fatalf("Expected the commit to be the head of the branch (%s), got %s", head, commit)
+	}
+	details, _ := runGit(repo, "log", "-1", "--format=%an <%ae>|%s", commit)
+	if details != "Bot <bot@example.com>|Apply multipilot task logging" {
+		t.Fatalf("Unexpected commit author and message: %s", details)
+	}
+	files, _ := runGit(repo, "show", "--name-only", "--format=", commit)
+	if files != "backend/main.go" {
+		t.Fatalf("Expected only the changes within cwd to be committed, got %s", files)
+	}
+}
+
+func TestCheckWorkingTree(t *testing.T) {
+	clean := &shared.RepoSnapshot{Commit: "abc", DirtyFiles: []string{}}
+	dirty := &shared.RepoSnapshot{Commit: "abc", DirtyFiles: []string{"README.md"}}
+	testCases := []struct {
+		task          shared.CopilotInput
+		base          *shared.RepoSnapshot
+		attempt       int32
+		expectedError string
+	}{
+		{task: shared.CopilotInput{Cwd: "/test/dir"}, base: nil, attempt: 1},
+		{task: shared.CopilotInput{Cwd: "/test/dir", Git: &shared.GitConfig{}}, base: nil, attempt: 1, expectedError: shared.ConfigurationError},
+		{task: shared.CopilotInput{Cwd: "/test/dir", Git: &shared.GitConfig{}}, base: clean, attempt: 1},
+		{task: shared.CopilotInput{Cwd: "/test/dir", Git: &shared.GitConfig{}}, base: dirty, attempt: 1, expectedError: shared.GitError},
+		{task: shared.CopilotInput{Cwd: "/test/dir", Git: &shared.GitConfig{AllowDirty: true}}, base: dirty, attempt: 1},
+		{task: shared.CopilotInput{Cwd: "/test/dir", Git: &shared.GitConfig{}}, base: dirty, attempt: 2},
+	}
+	for _, tc := range testCases {
+		err := checkWorkingTree(tc.task, tc.base, tc.attempt)
+		if tc.expectedError == "" {
+			if err != nil {
+				t.Fatalf("Not expecting an error, got %s", err.Error())
+			}
+			continue
+		}
+		var applicationErr *temporal.ApplicationError
+		if !errors.As(err, &applicationErr) || applicationErr.Type() != tc.expectedError || !applicationErr.NonRetryable() {
+			t.Fatalf("Expected a non-retryable %s, got %v", tc.expectedError, err)
+		}
+	}
+}
+
+func TestRepositoryInfo(t *testing.T) {
+	repo := initTestRepository(t)
+	if name, branch := RepositoryInfo(filepath.Join(repo, "backend")); name != filepath.Base(repo) || branch != "main" {
+		t.Fatalf("Expected repository %s on branch main, got %s on branch %q", filepath.Base(repo), name, branch)
+	}
+	if _, err := runGit(repo, "checkout", "--detach"); err != nil {
+		t.Fatal(err)
+	}
+	if name, branch := RepositoryInfo(repo); name != filepath.Base(repo) || branch != "" {
+		t.Fatalf("Expected no branch on a detached HEAD, got %s on branch %q", name, branch)
+	}
+	if name, branch := RepositoryInfo(t.TempDir()); name != "" || branch != "" {
+		t.Fatalf("Expected no repository outside of git, got %s on branch %q", name, branch)
+	}
+}
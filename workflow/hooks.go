@@ -0,0 +1,132 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/AstraBert/multipilot/shared"
+	"github.com/google/uuid"
+)
+
+type hookResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+	Err      error
+}
+
+// runHooks runs the hooks in order within the working directory of the task,
+// recording each of them as an event of the given type, and stops at the first
+// failing hook that is configured to fail the task.
+func runHooks(ctx context.Context, task shared.CopilotInput, hooks []shared.HookConfig, eventType, recordFile string, tracker *progressTracker) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	tracker.setPhase(shared.PhaseRunningHooks)
+	for _, hook := range hooks {
+		timeout := time.Duration(task.GetHookTimeout(hook)) * time.Second
+		result := runHook(ctx, task.Cwd, task.Env, hook.Command, timeout, tracker.heartbeat)
+		if err := appendRecord(recordFile, hookEvent(eventType, hook.Command, result)); err != nil {
+			log.Printf("An error occurred while writing the hook result to the log file: %s\n", err.Error())
+		}
+		if ctx.Err() != nil {
+			abortSession(nil, recordFile, ctx.Err())
+			return ctx.Err()
+		}
+		if result.ExitCode == 0 {
+			continue
+		}
+		if !hook.FailOnError {
+			log.Printf("Hook %q exited with code %d, ignoring\n", hook.Command, result.ExitCode)
+			continue
+		}
+		// a post hook runs on a tree Copilot already edited: retrying would run the
+		// whole task again on top of it
+		hookError := retryableError
+		if eventType == shared.PostHookEvent {
+			hookError = nonRetryableError
+		}
+		if result.Err != nil {
+			return hookError(shared.HookError, fmt.Errorf("hook %q failed: %s", hook.Command, result.Err.Error()))
+		}
+		return hookError(shared.HookError, fmt.Errorf("hook %q exited with code %d", hook.Command, result.ExitCode))
+	}
+	return nil
+}
+
+// runHook runs command with sh in cwd, calling heartbeat while it runs. An exit
+// code of -1 means that the command could not be started or timed out.
+func runHook(ctx context.Context, cwd string, env []string, command string, timeout time.Duration, heartbeat func()) hookResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), env...)
+	// do not wait for the processes started by the command once it is killed
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	started := time.Now()
+	done := make(chan error, 1)
+	if err := cmd.Start(); err != nil {
+		return hookResult{ExitCode: -1, Err: err}
+	}
+	go func() { done <- cmd.Wait() }()
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	var err error
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case <-ticker.C:
+			heartbeat()
+		}
+	}
+
+	result := hookResult{Stdout: truncateOutput(stdout.String()), Stderr: truncateOutput(stderr.String()), Duration: time.Since(started)}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		result.ExitCode = -1
+		result.Err = fmt.Errorf("timed out after %s", timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+		result.Err = err
+	}
+	return result
+}
+
+// truncateOutput keeps the end of long outputs, where failures are usually reported.
+func truncateOutput(output string) string {
+	if len(output) <= shared.MaxHookOutput {
+		return output
+	}
+	return "[truncated]\n" + output[len(output)-shared.MaxHookOutput:]
+}
+
+func hookEvent(eventType, command string, result hookResult) shared.CopilotEvent {
+	data := map[string]any{
+		"command":   command,
+		"exit_code": result.ExitCode,
+		"stdout":    result.Stdout,
+		"stderr":    result.Stderr,
+		"duration":  result.Duration.Round(time.Millisecond).String(),
+	}
+	if result.Err != nil {
+		data["error"] = result.Err.Error()
+	}
+	return shared.CopilotEvent{ID: uuid.New().String(), Timestamp: time.Now(), Type: eventType, Data: data}
+}
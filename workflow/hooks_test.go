@@ -0,0 +1,90 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstraBert/multipilot/shared"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestRunHook(t *testing.T) {
+	testCases := []struct {
+		command          string
+		timeout          time.Duration
+		expectedExitCode int
+		expectedStdout   string
+		expectedStderr   string
+		expectedError    bool
+	}{
+		{command: "echo $HOOK_MESSAGE; pwd", timeout: 10 * time.Second, expectedExitCode: 0, expectedStdout: "hello\n"},
+		{command: "echo failure >&2; exit 3", timeout: 10 * time.Second, expectedExitCode: 3, expectedStderr: "failure\n"},
+		{command: "sleep 5", timeout: 100 * time.Millisecond, expectedExitCode: -1, expectedError: true},
+	}
+	cwd := t.TempDir()
+	for _, tc := range testCases {
+		result := runHook(context.Background(), cwd, []string{"HOOK_MESSAGE=hello"}, tc.command, tc.timeout, func() {})
+		if result.ExitCode != tc.expectedExitCode {
+			t.Fatalf("Expected exit code %d for %q, got %d", tc.expectedExitCode, tc.command, result.ExitCode)
+		}
+		if !strings.HasPrefix(result.Stdout, tc.expectedStdout) || (tc.expectedStdout != "" && !strings.Contains(result.Stdout, cwd)) {
+			t.Fatalf("Expected stdout of %q to start with %q and contain the working directory, got %q", tc.command, tc.expectedStdout, result.Stdout)
+		}
+		if result.Stderr != tc.expectedStderr {
+			t.Fatalf("Expected stderr %q for %q, got %q", tc.expectedStderr, tc.command, result.Stderr)
+		}
+		if tc.expectedError != (result.Err != nil) {
+			t.Fatalf("Expected error to be %v for %q, got %v", tc.expectedError, tc.command, result.Err)
+		}
+	}
+}
+
+func TestHookEvent(t *testing.T) {
+	event := hookEvent(shared.PostHookEvent, "go test ./...", hookResult{ExitCode: 1, Stdout: "FAIL", Duration: 1500 * time.Millisecond})
+	if event.Type != shared.PostHookEvent || event.ID == "" {
+		t.Fatalf("Unexpected event type or id: %s, %s", event.Type, event.ID)
+	}
+	if event.Data["command"] != "go test ./..." || event.Data["exit_code"] != 1 || event.Data["stdout"] != "FAIL" || event.Data["duration"] != "1.5s" {
+		t.Fatalf("Unexpected event data: %v", event.Data)
+	}
+	if _, ok := event.Data["error"]; ok {
+		t.Fatalf("Expected no error within the event data, got %v", event.Data["error"])
+	}
+
+	long := strings.Repeat("a", shared.MaxHookOutput) + "end"
+	if truncated := truncateOutput(long); !strings.HasPrefix(truncated, "[truncated]\n") || !strings.HasSuffix(truncated, "end") || len(truncated) != len("[truncated]\n")+shared.MaxHookOutput {
+		t.Fatalf("Expected the output to be truncated to its end, got %d bytes", len(truncated))
+	}
+}
+
+func TestRunHooksRetries(t *testing.T) {
+	testCases := []struct {
+		eventType            string
+		expectedNonRetryable bool
+	}{
+		{eventType: shared.PreHookEvent, expectedNonRetryable: false},
+		{eventType: shared.PostHookEvent, expectedNonRetryable: true},
+	}
+	for _, tc := range testCases {
+		var suite testsuite.WorkflowTestSuite
+		env := suite.NewTestActivityEnvironment()
+		task := shared.CopilotInput{Cwd: t.TempDir()}
+		hooks := []shared.HookConfig{{Command: "exit 1", FailOnError: true}}
+		recordFile := filepath.Join(t.TempDir(), "hooks.jsonl")
+		env.RegisterActivityWithOptions(func(ctx context.Context) error {
+			return runHooks(ctx, task, hooks, tc.eventType, recordFile, newProgressTracker(ctx))
+		}, activity.RegisterOptions{Name: "hooks"})
+
+		_, err := env.ExecuteActivity("hooks")
+		var applicationErr *temporal.ApplicationError
+		if !errors.As(err, &applicationErr) || applicationErr.Type() != shared.HookError || applicationErr.NonRetryable() != tc.expectedNonRetryable {
+			t.Fatalf("Expected a %s with non-retryable %v for %s, got %v", shared.HookError, tc.expectedNonRetryable, tc.eventType, err)
+		}
+	}
+}
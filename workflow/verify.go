@@ -0,0 +1,53 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AstraBert/multipilot/shared"
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// verifyTurn runs the verify command after a turn and, as long as it fails and
+// iterations are left, sends its output back to the session to get it fixed.
+func verifyTurn(ctx context.Context, task shared.CopilotInput, session *copilot.Session, recordFile string, turn shared.CopilotTurn, tracker *progressTracker) error {
+	verify := task.GetVerify()
+	if verify == nil {
+		return nil
+	}
+	timeout := time.Duration(verify.Timeout) * time.Second
+	for iteration := 0; ; iteration++ {
+		tracker.setPhase(shared.PhaseVerifying)
+		result := runHook(ctx, task.Cwd, task.Env, verify.Command, timeout, tracker.heartbeat)
+		if err := appendRecord(recordFile, hookEvent(shared.VerifyEvent, verify.Command, result)); err != nil {
+			log.Printf("An error occurred while writing the verification result to the log file: %s\n", err.Error())
+		}
+		passed := result.ExitCode == 0
+		if passed || iteration == *verify.MaxIterations {
+			tracker.setVerification(passed)
+			if !passed && verify.FailOnError {
+				// re-running the whole task would edit the tree again from scratch
+				return nonRetryableError(shared.VerificationError, fmt.Errorf("verify command %q still fails after %d iteration(s)", verify.Command, iteration))
+			}
+			return nil
+		}
+		tracker.startIteration()
+		if err := sendTurn(ctx, session, recordFile, shared.CopilotTurn{Prompt: verifyPrompt(verify.Command, result), Timeout: turn.Timeout}); err != nil {
+			return sessionError(ctx, fmt.Errorf("an error occurred while sending the output of the verify command: %s", err.Error()))
+		}
+	}
+}
+
+func verifyPrompt(command string, result hookResult) string {
+	output := strings.TrimSpace(strings.TrimSpace(result.Stdout) + "\n" + strings.TrimSpace(result.Stderr))
+	if result.Err != nil {
+		output = strings.TrimSpace(output + "\n" + result.Err.Error())
+	}
+	if len(output) > shared.MaxVerifyFeedback {
+		output = "[truncated]\n" + output[len(output)-shared.MaxVerifyFeedback:]
+	}
+	return fmt.Sprintf("The command `%s` failed with exit code %d. Fix the issues it reports.\n\n```\n%s\n```", command, result.ExitCode, output)
+}
@@ -0,0 +1,69 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AstraBert/multipilot/shared"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestVerifyPrompt(t *testing.T) {
+	testCases := []struct {
+		result         hookResult
+		expectedPrompt string
+	}{
+		{
+			result:         hookResult{ExitCode: 1, Stdout: "--- FAIL: TestHandler\n", Stderr: "exit status 1\n"},
+			expectedPrompt: "The command `go test ./...` failed with exit code 1. Fix the issues it reports.\n\n```\n--- FAIL: TestHandler\nexit status 1\n```",
+		},
+		{
+			result:         hookResult{ExitCode: -1, Err: errors.New("timed out after 1m0s")},
+			expectedPrompt: "The command `go test ./...` failed with exit code -1. Fix the issues it reports.\n\n```\ntimed out after 1m0s\n```",
+		},
+	}
+	for _, tc := range testCases {
+		prompt := verifyPrompt("go test ./...", tc.result)
+		if prompt != tc.expectedPrompt {
+			t.Fatalf("Expected prompt %q, got %q", tc.expectedPrompt, prompt)
+		}
+	}
+
+	prompt := verifyPrompt("go test ./...", hookResult{ExitCode: 1, Stdout: strings.Repeat("a", shared.MaxVerifyFeedback) + "end"})
+	if !strings.Contains(prompt, "```\n[truncated]\n") || !strings.HasSuffix(prompt, "aend\n```") {
+		t.Fatalf("Expected the output to be truncated to its end, got %d bytes", len(prompt))
+	}
+}
+
+func TestVerifyTurnFailsWithoutRetrying(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestActivityEnvironment()
+	recordFile := filepath.Join(t.TempDir(), "verify.jsonl")
+	maxIterations := 0
+	task := shared.CopilotInput{Cwd: t.TempDir(), Verify: &shared.VerifyConfig{Command: "exit 1", MaxIterations: &maxIterations, FailOnError: true}}
+	env.RegisterActivityWithOptions(func(ctx context.Context) (shared.CopilotResult, error) {
+		tracker := newProgressTracker(ctx)
+		// no iteration is left, so the session is never used
+		err := verifyTurn(ctx, task, nil, recordFile, shared.CopilotTurn{}, tracker)
+		return tracker.result, err
+	}, activity.RegisterOptions{Name: "verify"})
+
+	_, err := env.ExecuteActivity("verify")
+	var applicationErr *temporal.ApplicationError
+	if !errors.As(err, &applicationErr) || applicationErr.Type() != shared.VerificationError || !applicationErr.NonRetryable() {
+		t.Fatalf("Expected a non-retryable %s, got %v", shared.VerificationError, err)
+	}
+	content, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), shared.VerifyEvent) != 1 {
+		t.Fatalf("Expected the check to run exactly once, got %s", content)
+	}
+}
@@ -9,37 +9,113 @@ import (
 )
 
 const CopilotTaskQueue string = "copilot-task-queue"
+const SendPromptSignal string = "send-prompt"
+const StatusQuery string = "status"
 
-func CopilotWorkflow(ctx workflow.Context, input shared.CopilotInput) error {
-
-	// RetryPolicy specifies how to automatically handle retries if an Activity fails.
-	retrypolicy := &temporal.RetryPolicy{
-		InitialInterval:    20 * time.Second,
-		BackoffCoefficient: 2.0,
-		MaximumInterval:    100 * time.Second,
-		MaximumAttempts:    10, // 0 is unlimited retries
+func CopilotWorkflow(ctx workflow.Context, input shared.CopilotInput) (shared.CopilotResult, error) {
+	status := shared.CopilotStatus{Phase: shared.PhaseRunning, StartedAt: workflow.GetInfo(ctx).WorkflowStartTime}
+	err := workflow.SetQueryHandler(ctx, StatusQuery, func() (shared.CopilotStatus, error) {
+		return status, nil
+	})
+	if err != nil {
+		return shared.CopilotResult{}, err
 	}
 
-	options := workflow.ActivityOptions{
-		// Timeout options specify when to automatically timeout Activity functions.
-		StartToCloseTimeout: 60 * time.Minute,
-		// Optionally provide a customized RetryPolicy.
-		// Temporal retries failed Activities by default.
-		RetryPolicy: retrypolicy,
-	}
+	options := activityOptions(input)
 
 	// Apply the options.
 	ctx = workflow.WithActivityOptions(ctx, options)
 
 	// Run Copilot
-	var output error
+	var result shared.CopilotResult
 
-	activityError := workflow.ExecuteActivity(ctx, RunCopilot, input).Get(ctx, &output)
+	activityError := workflow.ExecuteActivity(ctx, RunCopilot, input).Get(ctx, &result)
 	if activityError != nil {
-		return activityError
+		status.Phase = failedPhase(activityError)
+		return result, activityError
+	}
+
+	// Deliver follow-up prompts received while the task was running, then keep
+	// waiting for new ones until the follow-up window expires. Canceling the
+	// task closes the window. The prompts are only sent once all the turns of the
+	// task are done, by resuming its session on the host that ran it.
+	followUpCtx := ctx
+	if result.HostTaskQueue != "" {
+		followUpCtx = workflow.WithTaskQueue(ctx, result.HostTaskQueue)
+		// a host that stopped polling its task queue fails the follow-up, instead
+		// of keeping it waiting forever
+		followUpCtx = workflow.WithScheduleToStartTimeout(followUpCtx, options.StartToCloseTimeout)
 	}
-	if output != nil {
-		return output
+	prompts := workflow.GetSignalChannel(ctx, SendPromptSignal)
+	for {
+		var turn shared.CopilotTurn
+		if !prompts.ReceiveAsync(&turn) {
+			if input.FollowUpWindow <= 0 {
+				break
+			}
+			status.Phase = shared.PhaseWaitingForFollowUps
+			received := false
+			timerCtx, cancelTimer := workflow.WithCancel(ctx)
+			selector := workflow.NewSelector(ctx)
+			selector.AddReceive(prompts, func(c workflow.ReceiveChannel, more bool) {
+				c.Receive(ctx, &turn)
+				received = true
+			})
+			selector.AddFuture(workflow.NewTimer(timerCtx, time.Duration(input.FollowUpWindow)*time.Second), func(f workflow.Future) {})
+			selector.Select(ctx)
+			cancelTimer()
+			if !received {
+				break
+			}
+		}
+		if turn.Timeout <= 0 {
+			turn.Timeout = input.GetTimeout()
+		}
+		status.Phase = shared.PhaseRunningFollowUp
+		var followUp shared.CopilotResult
+		var base *shared.RepoSnapshot
+		if result.Diff != nil {
+			base = &result.Diff.Base
+		}
+		if err := workflow.ExecuteActivity(followUpCtx, SendPrompt, input, turn, base).Get(ctx, &followUp); err != nil {
+			status.Phase = failedPhase(err)
+			return result, err
+		}
+		result.Merge(followUp)
+		status.FollowUpsDelivered += 1
+	}
+	status.Phase = shared.PhaseCompleted
+	return result, nil
+}
+
+func failedPhase(err error) string {
+	if temporal.IsCanceledError(err) {
+		return shared.PhaseCanceled
+	}
+	return shared.PhaseFailed
+}
+
+func activityOptions(input shared.CopilotInput) workflow.ActivityOptions {
+	retry := input.GetRetry()
+
+	// RetryPolicy specifies how to automatically handle retries if an Activity fails.
+	retrypolicy := &temporal.RetryPolicy{
+		InitialInterval:        time.Duration(retry.InitialInterval) * time.Second,
+		BackoffCoefficient:     retry.BackoffCoefficient,
+		MaximumInterval:        time.Duration(retry.MaxInterval) * time.Second,
+		MaximumAttempts:        retry.MaxAttempts,
+		NonRetryableErrorTypes: retry.NonRetryableErrorTypes,
+	}
+
+	return workflow.ActivityOptions{
+		// Timeout options specify when to automatically timeout Activity functions.
+		StartToCloseTimeout: time.Duration(input.GetActivityTimeout()) * time.Second,
+		// A session that stops producing events and answering pings is considered dead.
+		HeartbeatTimeout: time.Duration(input.GetHeartbeatTimeout()) * time.Second,
+		// Let the session be torn down before the workflow is canceled.
+		WaitForCancellation: true,
+		// Optionally provide a customized RetryPolicy.
+		// Temporal retries failed Activities by default.
+		RetryPolicy: retrypolicy,
 	}
-	return nil
 }
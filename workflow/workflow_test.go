@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/AstraBert/multipilot/shared"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
 )
@@ -32,7 +34,7 @@ func TestUnitTestSuite(t *testing.T) {
 }
 
 func (s *UnitTestSuite) Test_CopilotWorkflow_RunCopilotFails() {
-	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(errors.New("activity failure"))
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{}, errors.New("activity failure"))
 	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl"})
 
 	s.True(s.env.IsWorkflowCompleted())
@@ -45,7 +47,7 @@ func (s *UnitTestSuite) Test_CopilotWorkflow_RunCopilotFails() {
 }
 
 func (s *UnitTestSuite) Test_CopilotWorkflow_RunCopilotSuccess() {
-	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(nil)
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{}, nil)
 	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl"})
 
 	s.True(s.env.IsWorkflowCompleted())
@@ -54,15 +56,187 @@ func (s *UnitTestSuite) Test_CopilotWorkflow_RunCopilotSuccess() {
 
 func (s *UnitTestSuite) Test_CopilotWorkflow_CorrectParam() {
 	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
-		func(ctx context.Context, inpt shared.CopilotInput) error {
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
 			s.Equal("hello.jsonl", inpt.LogFile)
 			s.Equal("/test/hello", inpt.Cwd)
 			s.Equal("Say hello and exit", inpt.Prompt)
 			s.Equal("gpt-5.1", inpt.AiModel)
-			return nil
+			return shared.CopilotResult{}, nil
 		})
 	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", Cwd: "/test/hello", Prompt: "Say hello and exit", AiModel: "gpt-5.1"})
 
 	s.True(s.env.IsWorkflowCompleted())
 	s.NoError(s.env.GetWorkflowError())
 }
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_FollowUpPrompt() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{}, nil)
+	s.env.OnActivity(SendPrompt, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput, turn shared.CopilotTurn, base *shared.RepoSnapshot) (shared.CopilotResult, error) {
+			s.Equal("Now write tests", turn.Prompt)
+			s.Equal(int64(300), turn.Timeout)
+			return shared.CopilotResult{}, nil
+		}).Once()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(SendPromptSignal, shared.CopilotTurn{Prompt: "Now write tests"})
+	}, time.Minute)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", Timeout: 300, FollowUpWindow: 600})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_FollowUpOnHostTaskQueue() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{HostTaskQueue: "copilot-task-queue-host1"}, nil)
+	s.env.OnActivity(SendPrompt, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput, turn shared.CopilotTurn, base *shared.RepoSnapshot) (shared.CopilotResult, error) {
+			s.Equal("copilot-task-queue-host1", activity.GetInfo(ctx).TaskQueue)
+			return shared.CopilotResult{}, nil
+		}).Once()
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(SendPromptSignal, shared.CopilotTurn{Prompt: "Now write tests"})
+	}, time.Minute)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", FollowUpWindow: 600})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_FollowUpWindowExpires() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{}, nil)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(SendPromptSignal, shared.CopilotTurn{Prompt: "Too late"})
+	}, 20*time.Minute)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", FollowUpWindow: 600})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_StatusQuery() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{}, nil)
+	s.env.RegisterDelayedCallback(func() {
+		result, err := s.env.QueryWorkflow(StatusQuery)
+		s.NoError(err)
+		var status shared.CopilotStatus
+		s.NoError(result.Get(&status))
+		s.Equal(shared.PhaseWaitingForFollowUps, status.Phase)
+	}, time.Minute)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", FollowUpWindow: 600})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	result, err := s.env.QueryWorkflow(StatusQuery)
+	s.NoError(err)
+	var status shared.CopilotStatus
+	s.NoError(result.Get(&status))
+	s.Equal(shared.PhaseCompleted, status.Phase)
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_HeartbeatTimeout() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			s.Equal(90*time.Second, activity.GetInfo(ctx).HeartbeatTimeout)
+			return shared.CopilotResult{}, nil
+		})
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", HeartbeatTimeout: 90})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_DefaultHeartbeatTimeout() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			s.Equal(time.Duration(shared.DefaultHeartbeatTimeout)*time.Second, activity.GetInfo(ctx).HeartbeatTimeout)
+			return shared.CopilotResult{}, nil
+		})
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl"})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_RetryPolicy() {
+	attempts := 0
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			attempts += 1
+			s.Equal(30*time.Minute, activity.GetInfo(ctx).StartToCloseTimeout)
+			return shared.CopilotResult{}, errors.New("activity failure")
+		})
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", ActivityTimeout: 1800, Retry: &shared.RetryConfig{MaxAttempts: 2, InitialInterval: 1}})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+	s.Equal(2, attempts)
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_NonRetryableErrorTypes() {
+	attempts := 0
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			attempts += 1
+			return shared.CopilotResult{}, temporal.NewApplicationError("session error", "SessionError")
+		})
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", Retry: &shared.RetryConfig{NonRetryableErrorTypes: []string{"SessionError"}}})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+	s.Equal(1, attempts)
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_NonRetryableConfigurationError() {
+	attempts := 0
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			attempts += 1
+			return shared.CopilotResult{}, nonRetryableError(shared.ConfigurationError, errors.New("log_file cannot be empty"))
+		})
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{})
+
+	s.True(s.env.IsWorkflowCompleted())
+	err := s.env.GetWorkflowError()
+	s.Error(err)
+	var applicationErr *temporal.ApplicationError
+	s.True(errors.As(err, &applicationErr))
+	s.Equal(shared.ConfigurationError, applicationErr.Type())
+	s.Equal(1, attempts)
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_ResultIncludesFollowUps() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(shared.CopilotResult{FinalMessage: "Done", Turns: 1, ToolCalls: 2, LogFile: "hello.jsonl"}, nil)
+	s.env.OnActivity(SendPrompt, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(shared.CopilotResult{FinalMessage: "Tests written", Turns: 1, ToolCalls: 3, LogFile: "hello.jsonl"}, nil)
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(SendPromptSignal, shared.CopilotTurn{Prompt: "Now write tests"})
+	}, time.Minute)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl", FollowUpWindow: 600})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	var result shared.CopilotResult
+	s.NoError(s.env.GetWorkflowResult(&result))
+	s.Equal("Tests written", result.FinalMessage)
+	s.Equal(2, result.Turns)
+	s.Equal(5, result.ToolCalls)
+}
+
+func (s *UnitTestSuite) Test_CopilotWorkflow_Canceled() {
+	s.env.OnActivity(RunCopilot, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, inpt shared.CopilotInput) (shared.CopilotResult, error) {
+			<-ctx.Done()
+			return shared.CopilotResult{}, ctx.Err()
+		})
+	s.env.RegisterDelayedCallback(func() {
+		s.env.CancelWorkflow()
+	}, 100*time.Millisecond)
+	s.env.ExecuteWorkflow(CopilotWorkflow, shared.CopilotInput{LogFile: "hello.jsonl"})
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(temporal.IsCanceledError(s.env.GetWorkflowError()))
+	response, err := s.env.QueryWorkflow(StatusQuery)
+	s.NoError(err)
+	var status shared.CopilotStatus
+	s.NoError(response.Get(&status))
+	s.Equal(shared.PhaseCanceled, status.Phase)
+}